@@ -2,18 +2,77 @@ package main
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/nickwells/check.mod/v2/check"
 	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/filecheck.mod/filecheck"
+	"github.com/nickwells/macros.mod/macros"
 	"github.com/nickwells/param.mod/v7/paction"
 	"github.com/nickwells/param.mod/v7/param"
 	"github.com/nickwells/param.mod/v7/psetter"
 )
 
 const (
-	paramNameShowRelease = "show-releases"
-	paramNameRelease     = "release"
+	paramNameShowRelease  = "show-releases"
+	paramNameShowOneRel   = "show-release"
+	paramNameRelease      = "release"
+	paramNameReapply      = "reapply"
+	paramNameResume       = "resume"
+	paramNamePlan         = "plan"
+	paramNamePlanFormat   = "plan-format"
+	paramNameRollback     = "rollback"
+	paramNameArchive      = "archive"
+	paramNameArchiveRel   = "archive-release"
+	paramNameInclArchive  = "include-archive"
+	paramNameUpdateSums   = "update-checksums"
+	paramNameApplyPend    = "apply-pending"
+	paramNameRelOrder     = "release-order"
+	paramNameShowDeps     = "show-dependencies"
+	paramNameShowSQL      = "show-sql"
+	paramNameShowFormat   = "show-format"
+	paramNameNoMacros     = "no-macros"
+	paramNameNoTranscript = "no-transcript"
+	paramNameNoWarn       = "no-warn"
+	paramNameAcceptWarn   = "accept-warning"
+	paramNameApprove      = "approve"
+	paramNameReviewer     = "reviewer"
+	paramNameNoHooks      = "no-hooks"
+	paramNameLockWait     = "lock-wait"
+
+	paramNameTargets         = "targets"
+	paramNameTargetsFile     = "targets-file"
+	paramNameMaxTargets      = "max-parallel-targets"
+	paramNameOnTargetFailure = "on-target-failure"
 )
 
+// noteExecSteps is the headline of the note describing how executable
+// steps are run
+const noteExecSteps = "dbt_apply_changes - Executable Steps"
+
+// modeParams are the parameters which choose what the program will do.
+// Exactly one of these must be given
+var modeParams = []string{
+	paramNameRelease,
+	paramNameShowRelease,
+	paramNameShowOneRel,
+	paramNameArchiveRel,
+	paramNameApplyPend,
+}
+
+// quotedList returns the names, quoted and separated by commas
+func quotedList(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, n := range names {
+		quoted = append(quoted, strconv.Quote(n))
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
 func addParams(prog *Prog) param.PSetOptFunc {
 	return func(ps *param.PSet) error {
 		var flagCounter paction.Counter
@@ -33,6 +92,9 @@ func addParams(prog *Prog) param.PSetOptFunc {
 				"), a file describing any concerns that you should"+
 				" address before applying the changes ("+
 				dbtcommon.ReleaseWarningFileName+
+				"), a manifest of the scripts to run to undo the"+
+				" release ("+
+				dbtcommon.ReleaseRollbackFileName+
 				") and a sub-directory called "+
 				dbtcommon.ReleaseSQLDirName+
 				" containing SQL files",
@@ -40,29 +102,574 @@ func addParams(prog *Prog) param.PSetOptFunc {
 			param.PostAction(flagCounter.MakeActionFunc()))
 
 		ps.Add(paramNameShowRelease, psetter.Bool{Value: &prog.doNotApply},
-			"print a message showing the available releases",
+			"print a message showing the available releases. The"+
+				" format of the message is given by the "+
+				paramNameShowFormat+" parameter",
 			param.Attrs(param.CommandLineOnly),
 			param.PostAction(flagCounter.MakeActionFunc()))
 
+		ps.Add(paramNameApplyPend, psetter.Bool{Value: &prog.applyPending},
+			"apply all the releases which the release ledger does not"+
+				" record as having been applied. The releases are"+
+				" applied one after another in the order given by the "+
+				paramNameRelOrder+" parameter, stopping at the first"+
+				" failure. If the "+paramNamePlan+" parameter is also"+
+				" given then the plan for each release is shown and"+
+				" nothing is applied",
+			param.AltNames("pending"),
+			param.Attrs(param.CommandLineOnly),
+			param.PostAction(flagCounter.MakeActionFunc()),
+			param.SeeAlso(paramNameRelOrder))
+
+		ps.Add(paramNameRelOrder,
+			psetter.Enum[string]{
+				Value: &prog.releaseOrder,
+				AllowedVals: psetter.AllowedVals[string]{
+					relOrderDeps: "by the release name except that a" +
+						" release is always applied after any releases" +
+						" it requires (given by the " +
+						dbtcommon.DirectiveRequires + " directive in the " +
+						dbtcommon.ReleaseManifestFileName + " file)",
+					relOrderName: "by the release name",
+					relOrderNumeric: "by the number at the start of the" +
+						" release name, releases with the same number" +
+						" are ordered by name. Every release name must" +
+						" start with a number",
+				},
+			},
+			"the rule used to choose the order in which pending"+
+				" releases are applied",
+			param.SeeAlso(paramNameApplyPend))
+
+		ps.Add(paramNameShowFormat,
+			psetter.Enum[string]{
+				Value: &prog.showFormat,
+				AllowedVals: psetter.AllowedVals[string]{
+					showFmtList: "a plain list of the release names",
+					showFmtTable: "a table showing, for each release," +
+						" the number of steps, whether it is valid and" +
+						" whether it has " +
+						dbtcommon.ReleaseReadMeFileName + ", " +
+						dbtcommon.ReleaseWarningFileName + " and " +
+						dbtcommon.ReleaseRollbackFileName + " files." +
+						" If a database is given the table also shows" +
+						" whether the release has been applied and when",
+					showFmtJSON: "the same details as for the table in" +
+						" JSON format, suitable for processing by" +
+						" other programs. This also gives the problems" +
+						" found with each invalid release and the" +
+						" releases it requires",
+				},
+			},
+			"the format in which the available releases are shown",
+			param.SeeAlso(paramNameShowRelease))
+
+		ps.Add(paramNameShowDeps, psetter.Bool{Value: &prog.showDeps},
+			"when showing the available releases also show the releases"+
+				" which each release requires, and the releases that they"+
+				" require and so on. A release requires another release"+
+				" if its "+dbtcommon.ReleaseManifestFileName+" file has a "+
+				dbtcommon.DirectiveRequires+" directive naming that"+
+				" release. The"+
+				" required releases may be in the "+
+				dbtcommon.ReleaseArchiveDirName+" directory. Any missing"+
+				" releases and any cycles are reported",
+			param.AltNames("show-deps"),
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameShowRelease))
+
+		ps.Add(paramNameInclArchive,
+			psetter.Bool{Value: &prog.includeArchive},
+			"when showing the available releases also show the releases"+
+				" in the "+dbtcommon.ReleaseArchiveDirName+" directory"+
+				" together with the date they were archived",
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameShowRelease))
+
+		ps.Add(paramNameArchive, psetter.Bool{Value: &prog.archive},
+			"after the release has been successfully applied move the"+
+				" release directory into the "+
+				dbtcommon.ReleaseArchiveDirName+" directory. The"+
+				" archived directory is given a name made from the"+
+				" release name and the time it was archived and a file ("+
+				dbtcommon.ReleaseAppliedFileName+") recording the"+
+				" details of the application is written into it",
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameRelease, paramNameArchiveRel))
+
+		ps.Add(paramNameShowOneRel,
+			psetter.String[string]{
+				Value: &prog.releaseName,
+			},
+			"show everything about the named release without applying"+
+				" it: the "+dbtcommon.ReleaseReadMeFileName+" and "+
+				dbtcommon.ReleaseWarningFileName+" files, the steps in"+
+				" the "+dbtcommon.ReleaseManifestFileName+" and "+
+				dbtcommon.ReleaseRollbackFileName+" files and in any"+
+				" hooks, with the type, number of lines and checksum"+
+				" of each file, the approval of the release and any"+
+				" problems with it. If a database is given the details"+
+				" also show whether the release has been applied. If"+
+				" the "+paramNameShowFormat+" is "+showFmtJSON+" the"+
+				" details are given in JSON format",
+			param.Attrs(param.CommandLineOnly),
+			param.PostAction(flagCounter.MakeActionFunc()),
+			param.PostAction(paction.SetVal(&prog.showOneRelease, true)),
+			param.SeeAlso(paramNameShowRelease, paramNameShowFormat))
+
+		ps.Add(paramNameArchiveRel,
+			psetter.String[string]{
+				Value: &prog.releaseName,
+			},
+			"move the named release, which must have already been"+
+				" applied, into the "+dbtcommon.ReleaseArchiveDirName+
+				" directory without applying it",
+			param.Attrs(param.CommandLineOnly),
+			param.PostAction(flagCounter.MakeActionFunc()),
+			param.PostAction(paction.SetVal(&prog.archiveOnly, true)),
+			param.SeeAlso(paramNameArchive))
+
 		ps.Add("quiet", psetter.Bool{Value: &prog.quiet},
 			"don't show the messages which announce the packages being"+
 				" applied and don't show the contents of the "+
 				dbtcommon.ReleaseReadMeFileName+
 				" file (if it exists)")
 
-		ps.Add("no-warn", psetter.Bool{Value: &prog.noWarn},
+		ps.Add(paramNameNoWarn, psetter.Bool{Value: &prog.noWarn},
 			"If there is a "+
 				dbtcommon.ReleaseWarningFileName+
 				" file don't show its contents and don't ask if you"+
-				" want to proceed")
+				" want to proceed",
+			param.SeeAlso(paramNameAcceptWarn))
+
+		ps.Add(paramNameAcceptWarn,
+			psetter.StrList[string]{
+				Value: &prog.acceptWarning,
+				Checks: []check.ValCk[[]string]{
+					check.SliceAll[[]string](
+						check.StringMatchesPattern[string](
+							dbtcommon.SHA256Pattern,
+							"a SHA-256 checksum: 64 lowercase hex digits")),
+				},
+			},
+			"the SHA-256 checksums of "+
+				dbtcommon.ReleaseWarningFileName+
+				" files which have been read and accepted. If the"+
+				" checksum of a release's "+
+				dbtcommon.ReleaseWarningFileName+
+				" file is one of these then its contents are shown but"+
+				" you are not asked if you want to proceed. If it is not"+
+				" then the release is not applied; any change to the"+
+				" file will need to be accepted again. This lets an"+
+				" automated run proceed only if someone has read exactly"+
+				" this warning. The checksum to give is shown with the"+
+				" warning and can also be found with sha256sum",
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameNoWarn))
+
+		ps.Add(paramNameReapply, psetter.Bool{Value: &prog.reapply},
+			"apply the release even if the release ledger records that it"+
+				" has already been successfully applied to the database",
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameRelease))
+
+		ps.Add(paramNameResume, psetter.Bool{Value: &prog.resume},
+			"resume the application of a release which has previously"+
+				" failed. The steps which were recorded as completed are"+
+				" skipped and the release restarts at the step which"+
+				" failed. The completed steps must match the start of the "+
+				dbtcommon.ReleaseManifestFileName+" exactly",
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameRelease))
+
+		ps.Add(paramNamePlan, psetter.Bool{Value: &prog.plan},
+			"check the release and show the steps that would be run"+
+				" without changing the database. Each step is shown with"+
+				" its type, the command that would be run and the size"+
+				" and checksum of the file",
+			param.AltNames("dry-run"),
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameRelease, paramNamePlanFormat))
+
+		ps.Add(paramNamePlanFormat,
+			psetter.Enum[string]{
+				Value: &prog.planFormat,
+				AllowedVals: psetter.AllowedVals[string]{
+					planFmtText: "plain text",
+					planFmtJSON: "JSON, suitable for processing by" +
+						" other programs",
+				},
+			},
+			"the format in which the plan is shown",
+			param.SeeAlso(paramNamePlan))
+
+		ps.Add("transaction", psetter.Bool{Value: &prog.inTransaction},
+			"apply all the SQL steps of the release in a single"+
+				" transaction so that if any step fails none of the"+
+				" changes are committed. This can also be requested by"+
+				" giving the "+dbtcommon.DirectiveTransaction+
+				" directive in the "+
+				dbtcommon.ReleaseManifestFileName+" file. Executable"+
+				" steps cannot take part in the transaction and must be"+
+				" marked with the "+dbtcommon.AttrNoTransaction+
+				" attribute, as"+
+				" must any SQL steps which cannot be run in a transaction"+
+				" (such as CREATE INDEX CONCURRENTLY). Such steps are run"+
+				" outside the transaction and any SQL steps before and"+
+				" after them are run in separate transactions",
+			param.AltNames("single-transaction", "tx"),
+			param.SeeAlso(paramNameRelease))
+
+		ps.Add(paramNameRollback, psetter.Bool{Value: &prog.rollback},
+			"undo the release by running the steps given in the "+
+				dbtcommon.ReleaseRollbackFileName+" file in the release"+
+				" directory rather than those in the "+
+				dbtcommon.ReleaseManifestFileName+" file. The "+
+				dbtcommon.ReleaseRollbackFileName+" file has the same"+
+				" format as the "+dbtcommon.ReleaseManifestFileName+
+				" file. The release ledger records the rollback and the"+
+				" release may then be applied again",
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameRelease))
+
+		ps.Add(paramNameUpdateSums, psetter.Bool{Value: &prog.updateSums},
+			"set the checksum of every step in the "+
+				dbtcommon.ReleaseManifestFileName+" (and "+
+				dbtcommon.ReleaseRollbackFileName+") file, and in the "+
+				dbtcommon.ReleaseManifestFileName+" file of any fragment"+
+				" they include, to the"+
+				" checksum of the current contents of the file. The"+
+				" checksum is given after the file name as "+
+				dbtcommon.AttrSHA256+"=<hex-digits>. If a step has a checksum"+
+				" then it will not be run if the contents of the file"+
+				" have changed. The release is not applied",
+			param.AltNames("update-sums"),
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameRelease))
+
+		ps.Add(paramNameApprove, psetter.Bool{Value: &prog.approve},
+			"record the approval of the release in the "+
+				dbtcommon.ReleaseApprovalFileName+" file in the"+
+				" release directory. This names the reviewers and holds"+
+				" the checksums of the "+
+				dbtcommon.ReleaseManifestFileName+" (and "+
+				dbtcommon.ReleaseRollbackFileName+") file, of every"+
+				" file listed, of any "+
+				dbtcommon.ReleaseWarningFileName+" file and of the hook"+
+				" files and their steps which are run with the release."+
+				" If the release has already been approved"+
+				" and has not changed since then the reviewers are added"+
+				" to the existing approval, otherwise the approval is"+
+				" replaced. The release is not applied",
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameReviewer, dbtcommon.DbtApprovalParamName))
+
+		ps.Add(paramNameReviewer,
+			psetter.StrList[string]{
+				Value: &prog.reviewers,
+				Checks: []check.ValCk[[]string]{
+					check.SliceAll[[]string](
+						check.StringMatchesPattern[string](
+							regexp.MustCompile(`^[^\s,:]+( [^\s,:]+)*$`),
+							"a name without commas or colons")),
+					check.SliceHasNoDups[[]string, string],
+				},
+			},
+			"the names of the people approving the release. Give several"+
+				" names separated by commas",
+			param.AltNames("reviewers"),
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameApprove))
+
+		ps.Add(paramNameNoMacros, psetter.Bool{Value: &prog.noMacros},
+			"do not substitute macros in the SQL files of the release."+
+				" By default any macros (names between "+
+				macros.DfltMStart+" and "+macros.DfltMEnd+") are"+
+				" replaced with the contents of the matching file in the"+
+				" macro directories, just as for "+
+				dbtcommon.DBSchemaDirName+" files",
+			param.SeeAlso(dbtcommon.MacroDirsParamName, paramNameShowSQL))
+
+		dbtcommon.AddParamMacroDirs(&prog.macroDirs, ps)
+
+		ps.Add(paramNameShowSQL, psetter.Bool{Value: &prog.showSQL},
+			"check the release and show the SQL of each SQL step, after"+
+				" any macros have been substituted, without changing"+
+				" the database",
+			param.AltNames("show-expanded-sql"),
+			param.Attrs(param.CommandLineOnly),
+			param.SeeAlso(paramNameRelease, paramNamePlan))
+
+		ps.AddNote(noteExecSteps, envVarsNote())
+
+		ps.AddNote(noteHooks, hooksNote())
+
+		ps.Add(paramNameNoHooks, psetter.Bool{Value: &prog.noHooks},
+			"do not run the steps in the "+dbtcommon.HookPreRelease+
+				" and "+dbtcommon.HookPostRelease+" hook files",
+			param.SeeNote(noteHooks))
+
+		ps.Add("clean-env", psetter.Bool{Value: &prog.cleanEnv},
+			"run each executable step with a minimal environment rather"+
+				" than the full environment of this program. The release"+
+				" variables described in the note are still set and any"+
+				" PG... variables are passed on",
+			param.AltNames("clean-environment"),
+			param.SeeNote(noteExecSteps))
+
+		ps.Add("transcript-dir",
+			psetter.Pathname{Value: &prog.transcriptDirName},
+			"the directory in which to write the transcript of the run."+
+				" By default this is the "+
+				dbtcommon.ReleaseTranscriptDirName+" sub-directory of"+
+				" the release directory. The transcript records the"+
+				" output of every step together with its exit status and"+
+				" duration, the contents of the "+
+				dbtcommon.ReleaseReadMeFileName+" and "+
+				dbtcommon.ReleaseWarningFileName+" files and your"+
+				" response to the warning. The directory will be created"+
+				" if it does not exist",
+			param.AltNames("log-dir"),
+			param.SeeAlso(paramNameNoTranscript))
 
+		ps.Add(paramNameNoTranscript, psetter.Bool{Value: &prog.noTranscript},
+			"do not write a transcript of the run",
+			param.SeeAlso("transcript-dir"))
+
+		ps.Add("step-timeout", psetter.Duration{Value: &prog.stepTimeout},
+			"the longest time that a step may run for before it is"+
+				" stopped. This applies to any step which does not have"+
+				" a "+dbtcommon.AttrTimeout+" attribute in the manifest"+
+				" (for instance, "+dbtcommon.AttrTimeout+"=15m). A value"+
+				" of zero means"+
+				" that there is no limit. A step which is stopped"+
+				" (together with any processes it has started) is"+
+				" treated as having failed but the program exits with a"+
+				" status of "+strconv.Itoa(exitStatusTimeout)+" rather"+
+				" than "+strconv.Itoa(exitStatusFailure)+". If the"+
+				" program is interrupted the running step is stopped"+
+				" in the same way and the program exits with a status"+
+				" of "+strconv.Itoa(exitStatusSignal)+" plus the signal"+
+				" number",
+			param.AltNames("timeout"))
+
+		ps.Add("max-parallel",
+			psetter.Int[int]{
+				Value: &prog.maxParallel,
+				Checks: []check.ValCk[int]{
+					check.ValGT(0),
+				},
+			},
+			"the greatest number of steps in a parallel group which may"+
+				" run at the same time. This applies to any group which"+
+				" does not have a "+dbtcommon.ParallelAttrMax+" attribute"+
+				" on its "+dbtcommon.DirectiveParallel+" line in the"+
+				" manifest (for instance, "+dbtcommon.DirectiveParallel+
+				" "+dbtcommon.ParallelAttrMax+"=8). The output of each"+
+				" step in the group is captured and shown, in manifest"+
+				" order, once the whole group has finished",
+			param.AltNames("parallel"))
+
+		ps.AddNote(noteLocking, lockingNote())
+
+		ps.Add(paramNameLockWait,
+			psetter.Duration{
+				Value: &prog.lockWait,
+				Checks: []check.Duration{
+					check.ValGE[time.Duration](0),
+				},
+			},
+			"how long to wait for the locks preventing concurrent"+
+				" releases if someone else holds them. The locks are"+
+				" tried again every "+lockRetryInterval.String()+". A"+
+				" value of zero means that the program fails at once if"+
+				" the locks are held",
+			param.AltNames("wait"),
+			param.SeeNote(noteLocking))
+
+		ps.AddNote(noteTargets, targetsNote())
+
+		ps.Add(paramNameTargets,
+			psetter.StrList[string]{
+				Value: &prog.targets,
+				Checks: []check.ValCk[[]string]{
+					check.SliceAll[[]string](
+						check.StringMatchesPattern[string](
+							targetNamePattern,
+							"a database name: a leading lowercase"+
+								" character followed by zero or more"+
+								" lowercase letters, digits or"+
+								" underscores")),
+					check.SliceHasNoDups[[]string, string],
+				},
+			},
+			"the names of the databases to which the release should be"+
+				" applied, separated by commas. The release is applied"+
+				" to each database in turn",
+			param.AltNames("target-dbs", "dbs"),
+			param.SeeAlso(paramNameTargetsFile, paramNameMaxTargets,
+				paramNameOnTargetFailure),
+			param.SeeNote(noteTargets))
+
+		ps.Add(paramNameTargetsFile,
+			psetter.Pathname{
+				Value:       &prog.targetsFile,
+				Expectation: filecheck.FileExists(),
+			},
+			"the name of a file listing the databases to which the"+
+				" release should be applied, one on each line",
+			param.SeeAlso(paramNameTargets),
+			param.SeeNote(noteTargets))
+
+		ps.Add(paramNameMaxTargets,
+			psetter.Int[int]{
+				Value: &prog.maxTargets,
+				Checks: []check.ValCk[int]{
+					check.ValGT(0),
+				},
+			},
+			"the greatest number of target databases to which the"+
+				" release may be applied at the same time",
+			param.AltNames("parallel-targets"),
+			param.SeeAlso(paramNameTargets, paramNameTargetsFile),
+			param.SeeNote(noteTargets))
+
+		ps.Add(paramNameOnTargetFailure,
+			psetter.Enum[string]{
+				Value: &prog.onTargetFailure,
+				AllowedVals: psetter.AllowedVals[string]{
+					targetFailStop: "do not start applying the release" +
+						" to any more databases. Any which have already" +
+						" been started are allowed to finish",
+					targetFailContinue: "carry on applying the release" +
+						" to the remaining databases",
+				},
+			},
+			"what to do if the release fails for one of the target"+
+				" databases",
+			param.SeeAlso(paramNameTargets, paramNameTargetsFile),
+			param.SeeNote(noteTargets))
+
+		ps.Add("ledger-schema",
+			psetter.String[string]{
+				Value: &prog.ledgerSchema,
+				Checks: []check.ValCk[string]{
+					check.StringMatchesPattern[string](
+						regexp.MustCompile(`^[a-z_][a-z0-9_]*$`),
+						"a schema name: a leading lowercase letter or"+
+							" underscore followed by zero or more lowercase"+
+							" letters, digits or underscores"),
+				},
+			},
+			"the name of the database schema holding the release ledger."+
+				" This table records the releases that have been applied"+
+				" to the database and the outcome of each attempt. The"+
+				" schema and table will be created if they do not exist")
+
+		// the database name is optional; if it is not given psql will
+		// connect to its default database
+		dbtcommon.AddParamDBName(prog.dbp, ps, param.Attrs(0))
 		dbtcommon.AddParamPsqlPath(prog.dbp, ps)
 
 		ps.AddFinalCheck(func() error {
 			if flagCounter.Count() == 0 {
+				return fmt.Errorf("you must set one of the parameters: %s",
+					quotedList(modeParams))
+			}
+
+			return nil
+		})
+		ps.AddFinalCheck(func() error {
+			if prog.archive &&
+				(prog.rollback || prog.plan || prog.updateSums ||
+					prog.showSQL) {
+				return fmt.Errorf(
+					"the %q parameter cannot be given with the %q, %q, %q"+
+						" or %q parameters",
+					paramNameArchive,
+					paramNameRollback, paramNamePlan, paramNameUpdateSums,
+					paramNameShowSQL)
+			}
+
+			return nil
+		})
+		ps.AddFinalCheck(func() error {
+			if prog.approve &&
+				(prog.archive || prog.rollback || prog.plan ||
+					prog.updateSums || prog.showSQL || prog.applyPending) {
+				return fmt.Errorf(
+					"the %q parameter cannot be given with the %q, %q, %q,"+
+						" %q, %q or %q parameters",
+					paramNameApprove,
+					paramNameArchive, paramNameRollback, paramNamePlan,
+					paramNameUpdateSums, paramNameShowSQL, paramNameApplyPend)
+			}
+
+			if prog.approve != (len(prog.reviewers) > 0) {
+				return fmt.Errorf(
+					"the %q and %q parameters must be given together",
+					paramNameApprove, paramNameReviewer)
+			}
+
+			return nil
+		})
+		ps.AddFinalCheck(func() error {
+			if prog.noWarn && len(prog.acceptWarning) > 0 {
+				return fmt.Errorf(
+					"the %q and %q parameters cannot both be given",
+					paramNameNoWarn, paramNameAcceptWarn)
+			}
+
+			return nil
+		})
+		ps.AddFinalCheck(func() error {
+			if prog.rollback && prog.resume {
+				return fmt.Errorf(
+					"the %q and %q parameters cannot both be given",
+					paramNameRollback, paramNameResume)
+			}
+
+			return nil
+		})
+		ps.AddFinalCheck(func() error {
+			if prog.applyPending && (prog.rollback || prog.updateSums) {
+				return fmt.Errorf(
+					"the %q parameter cannot be given with the %q or %q"+
+						" parameters",
+					paramNameApplyPend, paramNameRollback, paramNameUpdateSums)
+			}
+
+			return nil
+		})
+		ps.AddFinalCheck(func() error {
+			if !prog.hasTargets() {
+				return nil
+			}
+
+			if prog.dbp.DbName != "" {
+				return fmt.Errorf(
+					"a database name cannot be given with the %q or %q"+
+						" parameters",
+					paramNameTargets, paramNameTargetsFile)
+			}
+
+			if prog.releaseName == "" || prog.doNotApply ||
+				prog.showOneRelease ||
+				prog.applyPending || prog.archiveOnly || prog.archive ||
+				prog.plan || prog.showSQL || prog.updateSums ||
+				prog.approve {
 				return fmt.Errorf(
-					"you must set either the %q or the %q parameter",
-					paramNameRelease, paramNameShowRelease)
+					"the %q and %q parameters can only be given when"+
+						" applying or rolling back a single release;"+
+						" they cannot be given with the %s parameters",
+					paramNameTargets, paramNameTargetsFile,
+					quotedList([]string{
+						paramNameShowRelease, paramNameShowOneRel,
+						paramNameApplyPend,
+						paramNameArchiveRel, paramNameArchive,
+						paramNamePlan, paramNameShowSQL,
+						paramNameUpdateSums, paramNameApprove,
+					}))
 			}
 
 			return nil
@@ -70,8 +677,8 @@ func addParams(prog *Prog) param.PSetOptFunc {
 		ps.AddFinalCheck(func() error {
 			if flagCounter.Count() > 1 {
 				return fmt.Errorf(
-					"you must only set one of the %q or %q parameters",
-					paramNameRelease, paramNameShowRelease)
+					"you must only set one of the parameters: %s",
+					quotedList(modeParams))
 			}
 
 			return nil
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// releaseContents returns the checksums of the files which make up the
+// release, including those of the hooks to be run with it, as recorded in
+// the Approval file
+func (prog *Prog) releaseContents() (map[string]string, error) {
+	return dbtcommon.ReleaseContents(prog.dbp.BaseDirName, prog.releaseName,
+		prog.mf, prog.rollbackMf,
+		prog.hooks[dbtcommon.HookPreRelease],
+		prog.hooks[dbtcommon.HookPostRelease])
+}
+
+// checkApproval returns an error if the database requires that releases
+// are approved before they are applied and the release has no approval or
+// has changed since it was approved
+func (prog *Prog) checkApproval() error {
+	if !prog.dbp.ApprovalRequired() {
+		return nil
+	}
+
+	target := "this database"
+	if prog.dbp.DbName != "" {
+		target = fmt.Sprintf("the %q database", prog.dbp.DbName)
+	}
+
+	a, err := dbtcommon.ReadApproval(prog.dbp.BaseDirName, prog.releaseName)
+	if err != nil {
+		return err
+	}
+
+	if a == nil {
+		return fmt.Errorf("release %q must be approved before it can be"+
+			" applied to %s but it has no %s file."+
+			" Use the %q parameter to approve it",
+			prog.releaseName, target, dbtcommon.ReleaseApprovalFileName,
+			paramNameApprove)
+	}
+
+	files, err := prog.releaseContents()
+	if err != nil {
+		return err
+	}
+
+	if err := a.Check(prog.releaseName, files); err != nil {
+		return fmt.Errorf("release %q cannot be applied to %s: %w",
+			prog.releaseName, target, err)
+	}
+
+	if !prog.quiet {
+		fmt.Fprintf(prog.screen(), "Approved: %s by %s\n",
+			a.ApprovedAt.Format(time.DateOnly), strings.Join(a.Reviewers, ", "))
+	}
+
+	return nil
+}
+
+// approveRelease records the approval of the release by the reviewers in
+// the Approval file. If the release is already approved and has not
+// changed since then the reviewers are added to those who have already
+// approved it. Otherwise any existing approval is replaced.
+func (prog *Prog) approveRelease() error {
+	files, err := prog.releaseContents()
+	if err != nil {
+		return err
+	}
+
+	a, err := dbtcommon.ReadApproval(prog.dbp.BaseDirName, prog.releaseName)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	switch {
+	case a == nil:
+		a = dbtcommon.NewApproval(prog.releaseName, prog.reviewers, files, now)
+	case a.Check(prog.releaseName, files) == nil:
+		a.AddReviewers(prog.reviewers)
+		a.ApprovedAt = now
+	default:
+		fmt.Printf("The previous approval by %s is out of date"+
+			" and has been replaced\n", strings.Join(a.Reviewers, ", "))
+
+		a = dbtcommon.NewApproval(prog.releaseName, prog.reviewers, files, now)
+	}
+
+	if err := dbtcommon.WriteApproval(prog.dbp.BaseDirName, a); err != nil {
+		return err
+	}
+
+	fmt.Printf("Release %q approved by: %s\n",
+		prog.releaseName, strings.Join(a.Reviewers, ", "))
+
+	return nil
+}
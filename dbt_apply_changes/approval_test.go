@@ -0,0 +1,186 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestApproval(t *testing.T) {
+	prog := mkTestRelease(t, map[string]string{
+		dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n",
+		dbtcommon.ReleaseRollbackFileName: "SQL.files/undo.sql\n",
+		"SQL.files/a.sql":                 "select 1;\n",
+		"SQL.files/undo.sql":              "select 2;\n",
+	})
+	prog.quiet = true
+	prog.dbp.DbName = "prod_eu"
+	prog.dbp.ApprovalRequiredFor = regexp.MustCompile("^prod")
+
+	if errs := prog.parseManifest(); len(errs) > 0 {
+		t.Fatal("cannot parse the manifest:", errs)
+	}
+
+	type expErr struct {
+		testhelper.ID
+		testhelper.ExpErr
+	}
+
+	testhelper.CheckExpErr(t, prog.checkApproval(),
+		expErr{
+			ID: testhelper.MkID("not approved"),
+			ExpErr: testhelper.MkExpErr(
+				`release "testRel" must be approved before it can be` +
+					` applied to the "prod_eu" database`),
+		})
+
+	prog.reviewers = []string{"alice"}
+	if err := prog.approveRelease(); err != nil {
+		t.Fatal("cannot approve the release:", err)
+	}
+
+	prog.reviewers = []string{"bob", "alice"}
+	if err := prog.approveRelease(); err != nil {
+		t.Fatal("cannot approve the release:", err)
+	}
+
+	a, err := dbtcommon.ReadApproval(prog.dbp.BaseDirName, testRelName)
+	if err != nil || a == nil {
+		t.Fatal("cannot read the approval:", err)
+	}
+
+	testhelper.DiffStringSlice(t, "approval", "reviewers",
+		a.Reviewers, []string{"alice", "bob"})
+	testhelper.DiffInt(t, "approval", "files", len(a.Files), 4)
+
+	testhelper.CheckExpErr(t, prog.checkApproval(),
+		expErr{ID: testhelper.MkID("approved")})
+
+	prog.dbp.DbName = "dev"
+	testhelper.CheckExpErr(t, prog.checkApproval(),
+		expErr{ID: testhelper.MkID("approval not required")})
+
+	prog.dbp.DbName = "prod_eu"
+
+	undo := filepath.Join(
+		dbtcommon.DbtDirReleaseSQL(prog.dbp.BaseDirName, testRelName),
+		"undo.sql")
+	err = os.WriteFile(undo, []byte("select 3;\n"), 0o644) //nolint:gosec
+	if err != nil {
+		t.Fatal("cannot change the rollback file:", err)
+	}
+
+	testhelper.CheckExpErr(t, prog.checkApproval(),
+		expErr{
+			ID: testhelper.MkID("changed since approval"),
+			ExpErr: testhelper.MkExpErr(
+				"the release has changed since it was approved",
+				"by alice, bob",
+				"changed: SQL.files/undo.sql"),
+		})
+
+	prog.reviewers = []string{"carol"}
+	if err := prog.approveRelease(); err != nil {
+		t.Fatal("cannot approve the release:", err)
+	}
+
+	a, err = dbtcommon.ReadApproval(prog.dbp.BaseDirName, testRelName)
+	if err != nil || a == nil {
+		t.Fatal("cannot read the approval:", err)
+	}
+
+	testhelper.DiffStringSlice(t, "replaced approval", "reviewers",
+		a.Reviewers, []string{"carol"})
+	testhelper.CheckExpErr(t, prog.checkApproval(),
+		expErr{ID: testhelper.MkID("approved again")})
+}
+
+func TestReleaseContents(t *testing.T) {
+	prog := mkTestRelease(t, map[string]string{
+		dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n",
+		dbtcommon.ReleaseWarningFileName:  "this may take a while\n",
+		"SQL.files/a.sql":                 "select 1;\n",
+		"../Hooks/PreRelease":             "backup.sh\n",
+		"../Hooks/backup.sh":              "#!/bin/sh\n",
+	})
+	prog.quiet = true
+	prog.dbp.ApprovalRequiredFor = regexp.MustCompile(".")
+
+	if errs := prog.parseManifest(); len(errs) > 0 {
+		t.Fatal("cannot parse the manifest:", errs)
+	}
+
+	if errs := prog.parseHooks(); len(errs) > 0 {
+		t.Fatal("cannot parse the hooks:", errs)
+	}
+
+	files, err := prog.releaseContents()
+	if err != nil {
+		t.Fatal("cannot get the release contents:", err)
+	}
+
+	testhelper.DiffStringSlice(t, "releaseContents", "files",
+		slices.Sorted(maps.Keys(files)),
+		[]string{
+			"../Hooks/PreRelease",
+			"../Hooks/backup.sh",
+			dbtcommon.ReleaseManifestFileName,
+			"SQL.files/a.sql",
+			dbtcommon.ReleaseWarningFileName,
+		})
+
+	prog.reviewers = []string{"alice"}
+	if err := prog.approveRelease(); err != nil {
+		t.Fatal("cannot approve the release:", err)
+	}
+
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		fileName string
+	}{
+		{
+			ID: testhelper.MkID("hook step changed"),
+			ExpErr: testhelper.MkExpErr(
+				"the release has changed since it was approved",
+				"changed: ../Hooks/backup.sh"),
+			fileName: filepath.Join(
+				dbtcommon.DbtDirReleaseHooks(prog.dbp.BaseDirName),
+				"backup.sh"),
+		},
+		{
+			ID: testhelper.MkID("Warning changed"),
+			ExpErr: testhelper.MkExpErr(
+				"the release has changed since it was approved",
+				"changed: "+dbtcommon.ReleaseWarningFileName),
+			fileName: dbtcommon.DbtFileReleaseWarning(
+				prog.dbp.BaseDirName, testRelName),
+		},
+	}
+
+	for _, tc := range testCases {
+		orig, err := os.ReadFile(tc.fileName)
+		if err != nil {
+			t.Fatal(tc.IDStr(), ": cannot read the file:", err)
+		}
+
+		err = os.WriteFile(tc.fileName, //nolint:gosec
+			append(orig, "# changed\n"...), 0o644)
+		if err != nil {
+			t.Fatal(tc.IDStr(), ": cannot change the file:", err)
+		}
+
+		testhelper.CheckExpErr(t, prog.checkApproval(), tc)
+
+		err = os.WriteFile(tc.fileName, orig, 0o644) //nolint:gosec
+		if err != nil {
+			t.Fatal(tc.IDStr(), ": cannot restore the file:", err)
+		}
+	}
+}
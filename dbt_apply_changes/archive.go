@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// archiveTimeFmt is the format of the time added to the name of an archived
+// release directory
+const archiveTimeFmt = "20060102-150405"
+
+// archiveDirName returns a name for the archived release directory which
+// is not already in use. The name is made from the release name and the
+// time of archiving with a numeric suffix added if necessary.
+func archiveDirName(archiveDir, relName string, t time.Time) (string, error) {
+	base := relName + "." + t.Format(archiveTimeFmt)
+	name := base
+
+	for i := 1; ; i++ {
+		_, err := os.Stat(filepath.Join(archiveDir, name))
+		if os.IsNotExist(err) {
+			return name, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		name = base + "." + strconv.Itoa(i)
+	}
+}
+
+// writeAppliedFile writes the applied-metadata file into the archived
+// release directory
+func (prog *Prog) writeAppliedFile(dir string, t time.Time) error {
+	var meta strings.Builder
+
+	fmt.Fprintf(&meta, "%s: %s\n", dbtcommon.AppliedKeyRel, prog.releaseName)
+	fmt.Fprintf(&meta, "%s: %s\n",
+		dbtcommon.AppliedKeyTime, t.Format(dbtcommon.AppliedTimeFmt))
+	fmt.Fprintf(&meta, "%s: %s\n", dbtcommon.AppliedKeyDB, prog.dbp.DbName)
+	fmt.Fprintf(&meta, "%s: %s\n", dbtcommon.AppliedKeyUser, osUserName())
+	fmt.Fprintf(&meta, "%s: %s\n", dbtcommon.AppliedKeyHost, hostName())
+	fmt.Fprintf(&meta, "%s: %s\n",
+		dbtcommon.AppliedKeyVsn, dbtcommon.ToolVersion())
+
+	if prog.ledgerID != 0 {
+		fmt.Fprintf(&meta, "%s: %d\n",
+			dbtcommon.AppliedKeyLedger, prog.ledgerID)
+	}
+
+	return os.WriteFile(
+		filepath.Join(dir, dbtcommon.ReleaseAppliedFileName),
+		[]byte(meta.String()), 0o644) //nolint:gosec
+}
+
+// archiveRelease moves the release directory into the Archive directory
+// and writes a file recording when it was archived
+func (prog *Prog) archiveRelease() error {
+	archiveDir := dbtcommon.DbtDirReleaseArchive(prog.dbp.BaseDirName)
+	if err := os.MkdirAll(archiveDir, 0o755); err != nil { //nolint:gosec
+		return fmt.Errorf("creating the archive directory: %w", err)
+	}
+
+	now := time.Now()
+
+	name, err := archiveDirName(archiveDir, prog.releaseName, now)
+	if err != nil {
+		return fmt.Errorf("choosing the archive name for %q: %w",
+			prog.releaseName, err)
+	}
+
+	relDir := dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, prog.releaseName)
+	arcDir := filepath.Join(archiveDir, name)
+
+	if err := os.Rename(relDir, arcDir); err != nil {
+		return fmt.Errorf("archiving %q: %w", prog.releaseName, err)
+	}
+
+	if err := prog.writeAppliedFile(arcDir, now); err != nil {
+		return fmt.Errorf("writing the %s file for the archived release: %w",
+			dbtcommon.ReleaseAppliedFileName, err)
+	}
+
+	if !prog.quiet {
+		fmt.Println("Release archived as:", arcDir)
+	}
+
+	return nil
+}
+
+// archiveAppliedRelease archives a release which has already been applied.
+// It is an error if the release ledger does not record the release as
+// applied
+func (prog *Prog) archiveAppliedRelease() error {
+	if err := prog.createLedger(); err != nil {
+		return err
+	}
+
+	applied, err := prog.releaseIsApplied(prog.releaseName)
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		return fmt.Errorf(
+			"the release %q cannot be archived: the release ledger (%s)"+
+				" does not record it as applied",
+			prog.releaseName, prog.ledgerTable())
+	}
+
+	return prog.archiveRelease()
+}
+
+// findArchivedReleases finds all the releases in the Archive directory
+func (prog *Prog) findArchivedReleases() ([]dbtcommon.ArchivedRelease, error) {
+	return dbtcommon.FindArchivedReleases(prog.dbp.BaseDirName)
+}
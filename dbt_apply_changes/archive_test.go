@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestArchiveDirName(t *testing.T) {
+	archivedAt := time.Date(2026, 10, 18, 9, 8, 7, 0, time.UTC)
+
+	testCases := []struct {
+		testhelper.ID
+		existing []string
+		expName  string
+	}{
+		{
+			ID:      testhelper.MkID("empty archive"),
+			expName: "rel.20261018-090807",
+		},
+		{
+			ID:       testhelper.MkID("other releases archived"),
+			existing: []string{"other.20261018-090807", "rel.20261017-090807"},
+			expName:  "rel.20261018-090807",
+		},
+		{
+			ID:       testhelper.MkID("name in use"),
+			existing: []string{"rel.20261018-090807"},
+			expName:  "rel.20261018-090807.1",
+		},
+		{
+			ID: testhelper.MkID("name and first suffix in use"),
+			existing: []string{
+				"rel.20261018-090807", "rel.20261018-090807.1",
+			},
+			expName: "rel.20261018-090807.2",
+		},
+	}
+
+	for _, tc := range testCases {
+		archiveDir := t.TempDir()
+
+		for _, name := range tc.existing {
+			err := os.Mkdir(filepath.Join(archiveDir, name), //nolint:gosec
+				0o755)
+			if err != nil {
+				t.Fatal("cannot make the archived release:", err)
+			}
+		}
+
+		name, err := archiveDirName(archiveDir, "rel", archivedAt)
+		if err != nil {
+			t.Fatal(tc.IDStr(), ": unexpected error:", err)
+		}
+
+		testhelper.DiffString(t, tc.IDStr(), "name", name, tc.expName)
+	}
+}
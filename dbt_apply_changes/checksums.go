@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/location.mod/location"
+)
+
+// checksumParser records the new content of each line of a manifest file
+// which gives a step: the file name and attributes with the checksum
+// attribute set to the checksum of the current contents of the file
+type checksumParser struct {
+	// dir is the directory which the files in the manifest are relative to
+	dir   string
+	lines map[int64]string
+}
+
+// ParseLine records the new content of the line if it gives a step. The
+// line is given with any comment removed. Directives are ignored
+func (cp *checksumParser) ParseLine(line string, loc *location.L) error {
+	parts := strings.Fields(line)
+	if strings.HasPrefix(parts[0], dbtcommon.DirectivePrefix) {
+		return nil
+	}
+
+	sum, err := dbtcommon.FileSHA256(filepath.Join(cp.dir, parts[0]))
+	if err != nil {
+		return loc.Error(err.Error())
+	}
+
+	fields := []string{parts[0]}
+
+	for _, attr := range parts[1:] {
+		if key, _, _ := strings.Cut(attr, "="); key != dbtcommon.AttrSHA256 {
+			fields = append(fields, attr)
+		}
+	}
+
+	fields = append(fields, dbtcommon.AttrSHA256+"="+sum)
+
+	cp.lines[loc.Idx()] = strings.Join(fields, " ")
+
+	return nil
+}
+
+// updateManifestChecksums rewrites the manifest file, setting the checksum
+// attribute of every step to the checksum of the current contents of the
+// file. The files are found relative to the directory holding the manifest
+// file. Blank lines, comments and directives are left unchanged as is any
+// trailing comment.
+func updateManifestChecksums(mf *dbtcommon.Manifest) error {
+	cp := &checksumParser{
+		dir:   filepath.Dir(mf.FileName),
+		lines: map[int64]string{},
+	}
+
+	fp := dbtcommon.NewManifestFileParser(filepath.Base(mf.FileName), cp)
+	if errs := fp.Parse(mf.FileName); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	content, err := os.ReadFile(mf.FileName)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+
+	for i, line := range lines {
+		newLine, ok := cp.lines[int64(i+1)]
+		if !ok {
+			continue
+		}
+
+		_, comment, hasComment := strings.Cut(line,
+			dbtcommon.ManifestCommentIntro)
+		if hasComment {
+			newLine += " " + dbtcommon.ManifestCommentIntro + comment
+		}
+
+		lines[i] = newLine
+	}
+
+	fStat, err := os.Stat(mf.FileName)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(mf.FileName,
+		[]byte(strings.Join(lines, "\n")+"\n"), fStat.Mode().Perm())
+}
+
+// updateChecksums rewrites the Manifest file, any Rollback file and the
+// Manifest file of any fragment they include with the checksums of the
+// current contents of each file
+func (prog *Prog) updateChecksums() error {
+	var mfs []*dbtcommon.Manifest
+
+	seen := map[string]bool{}
+
+	for _, mf := range []*dbtcommon.Manifest{prog.mf, prog.rollbackMf} {
+		if mf == nil {
+			continue
+		}
+
+		for _, m := range append([]*dbtcommon.Manifest{mf}, mf.Fragments...) {
+			if !seen[m.FileName] {
+				seen[m.FileName] = true
+				mfs = append(mfs, m)
+			}
+		}
+	}
+
+	for _, mf := range mfs {
+		if err := updateManifestChecksums(mf); err != nil {
+			return fmt.Errorf("updating the checksums in %s: %w",
+				mf.FileName, err)
+		}
+
+		if !prog.quiet {
+			fmt.Println("Checksums updated:", mf.FileName)
+		}
+	}
+
+	return nil
+}
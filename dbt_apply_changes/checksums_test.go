@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestUpdateChecksums(t *testing.T) {
+	const (
+		aSQL     = "select 1;\n"
+		grantSQL = "grant;\n"
+		staleSum = "4a45092ccf992ea92250053a80b931b7" +
+			"87924ba61648f420555511b84f10ab6c"
+	)
+
+	prog := mkTestRelease(t, map[string]string{
+		dbtcommon.ReleaseManifestFileName: "# the release steps\n" +
+			"\n" +
+			"SQL.files/a.sql timeout=5m sha256=" + staleSum + " # step one\n" +
+			"@include grants # the grants\n",
+		"SQL.files/a.sql":                      aSQL,
+		"../Common/grants/Manifest":            "SQL.files/grant.sql\n",
+		"../Common/grants/SQL.files/grant.sql": grantSQL,
+	})
+	prog.quiet = true
+	prog.updateSums = true
+
+	if errs := prog.parseManifest(); len(errs) > 0 {
+		t.Fatal("cannot parse the manifest:", errs)
+	}
+
+	if err := prog.updateChecksums(); err != nil {
+		t.Fatal("cannot update the checksums:", err)
+	}
+
+	testCases := []struct {
+		testhelper.ID
+		fileName string
+		expText  string
+	}{
+		{
+			ID:       testhelper.MkID("release manifest"),
+			fileName: prog.mf.FileName,
+			expText: "# the release steps\n" +
+				"\n" +
+				"SQL.files/a.sql timeout=5m sha256=" +
+				dbtcommon.BytesSHA256([]byte(aSQL)) + " # step one\n" +
+				"@include grants # the grants\n",
+		},
+		{
+			ID: testhelper.MkID("fragment manifest"),
+			fileName: filepath.Join(
+				dbtcommon.DbtDirReleaseFragment(
+					prog.dbp.BaseDirName, "grants"),
+				dbtcommon.ReleaseManifestFileName),
+			expText: "SQL.files/grant.sql sha256=" +
+				dbtcommon.BytesSHA256([]byte(grantSQL)) + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		text, err := os.ReadFile(tc.fileName)
+		if err != nil {
+			t.Fatal(tc.IDStr(), ": cannot read the manifest:", err)
+		}
+
+		testhelper.DiffString(t, tc.IDStr(), "text", string(text), tc.expText)
+	}
+
+	prog.updateSums = false
+	prog.setRelease(testRelName)
+
+	if errs := prog.parseManifest(); len(errs) > 0 {
+		t.Error("the updated checksums should match:", errs)
+	}
+}
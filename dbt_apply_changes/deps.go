@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// relNode records the releases required by a release
+type relNode struct {
+	name     string
+	requires []string
+	archived bool
+}
+
+// relGraph holds the dependencies between releases, keyed by release name
+type relGraph map[string]*relNode
+
+// releaseGraph reads the requirements of every release, including those in
+// the Archive directory, and returns the resulting graph. If a release is
+// both in the release directory and in the Archive directory the
+// requirements of the unarchived release are used.
+func (prog *Prog) releaseGraph() (relGraph, []error) {
+	var errs []error
+
+	g := relGraph{}
+
+	archived, err := prog.findArchivedReleases()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	archiveDir := dbtcommon.DbtDirReleaseArchive(prog.dbp.BaseDirName)
+
+	for _, ar := range archived {
+		reqs, rErrs := dbtcommon.ReadRequires(
+			filepath.Join(archiveDir, ar.DirName,
+				dbtcommon.ReleaseManifestFileName),
+			ar.Name)
+		errs = append(errs, rErrs...)
+		g[ar.Name] = &relNode{name: ar.Name, requires: reqs, archived: true}
+	}
+
+	releases, err := prog.findReleases()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, r := range releases {
+		reqs, rErrs := dbtcommon.ReadRequires(
+			dbtcommon.DbtFileReleaseManifest(prog.dbp.BaseDirName, r), r)
+		errs = append(errs, rErrs...)
+		g[r] = &relNode{name: r, requires: reqs}
+	}
+
+	return g, errs
+}
+
+// check returns errors for any required releases which do not exist and
+// for any cycles among the releases reachable from the named releases
+func (g relGraph) check(names []string) []error {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+
+	var (
+		errs  []error
+		path  []string
+		state = map[string]int{}
+	)
+
+	var visit func(name string)
+	visit = func(name string) {
+		switch state[name] {
+		case done:
+			return
+		case inProgress:
+			start := slices.Index(path, name)
+			errs = append(errs,
+				fmt.Errorf("there is a cycle in the release dependencies: %s",
+					strings.Join(append(slices.Clone(path[start:]), name),
+						" -> ")))
+
+			return
+		}
+
+		state[name] = inProgress
+		path = append(path, name)
+
+		for _, req := range g[name].requires {
+			if _, ok := g[req]; !ok {
+				errs = append(errs,
+					fmt.Errorf("the release %q requires %q which is not"+
+						" an available or archived release",
+						name, req))
+
+				continue
+			}
+
+			visit(req)
+		}
+
+		path = path[:len(path)-1]
+		state[name] = done
+	}
+
+	for _, name := range names {
+		if _, ok := g[name]; ok {
+			visit(name)
+		}
+	}
+
+	return errs
+}
+
+// allRequired returns the names of all the releases which the named release
+// requires, either directly or indirectly, sorted by name. The graph must
+// have been checked before this is called.
+func (g relGraph) allRequired(name string) []string {
+	seen := map[string]bool{}
+
+	var visit func(name string)
+	visit = func(name string) {
+		for _, req := range g[name].requires {
+			if !seen[req] {
+				seen[req] = true
+				visit(req)
+			}
+		}
+	}
+
+	visit(name)
+
+	reqs := make([]string, 0, len(seen))
+	for r := range seen {
+		reqs = append(reqs, r)
+	}
+
+	sort.Strings(reqs)
+
+	return reqs
+}
+
+// order sorts the named releases so that each release comes after any of
+// the named releases which it requires, either directly or indirectly.
+// Otherwise the releases are in name order. The graph must have been
+// checked before this is called.
+func (g relGraph) order(names []string) {
+	wanted := map[string]bool{}
+	for _, n := range names {
+		wanted[n] = true
+	}
+
+	sort.Strings(names)
+
+	ordered := make([]string, 0, len(names))
+	seen := map[string]bool{}
+
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+
+		seen[name] = true
+
+		for _, req := range g[name].requires {
+			visit(req)
+		}
+
+		if wanted[name] {
+			ordered = append(ordered, name)
+		}
+	}
+
+	for _, n := range names {
+		visit(n)
+	}
+
+	copy(names, ordered)
+}
+
+// checkDependencies checks that every release required by the release has
+// been applied. It returns an error if the dependencies are not valid or
+// if any required release has not been applied
+func (prog *Prog) checkDependencies() error {
+	g, errs := prog.releaseGraph()
+	errs = append(errs, g.check([]string{prog.releaseName})...)
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	var unapplied []string
+
+	for _, req := range g.allRequired(prog.releaseName) {
+		applied, err := prog.releaseIsApplied(req)
+		if err != nil {
+			return err
+		}
+
+		if !applied {
+			unapplied = append(unapplied, req)
+		}
+	}
+
+	if len(unapplied) > 0 {
+		return fmt.Errorf(
+			"the release %q cannot be applied, the release ledger (%s)"+
+				" does not record these required releases as applied: %s",
+			prog.releaseName, prog.ledgerTable(),
+			strings.Join(unapplied, ", "))
+	}
+
+	return nil
+}
+
+// showDependencies prints the releases required by the named release,
+// indented under it, and then the releases they require and so on. Each
+// release is only expanded once on any path so that a cycle is shown but
+// not followed
+func (g relGraph) showDependencies(name, indent string, path []string) {
+	for _, req := range g[name].requires {
+		var note string
+
+		node, ok := g[req]
+
+		switch {
+		case !ok:
+			note = " (missing)"
+		case slices.Contains(path, req):
+			note = " (cycle)"
+		case node.archived:
+			note = " (archived)"
+		}
+
+		fmt.Println(indent+"requires:", req+note)
+
+		if ok && note != " (cycle)" {
+			g.showDependencies(req, indent+"    ",
+				slices.Concat(path, []string{req}))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+// mkTestGraph makes a release graph from a map of release names to the
+// names of the releases they require
+func mkTestGraph(deps map[string][]string) relGraph {
+	g := relGraph{}
+	for name, reqs := range deps {
+		g[name] = &relNode{name: name, requires: reqs}
+	}
+
+	return g
+}
+
+func TestRelGraph(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		deps     map[string][]string
+		releases []string
+		expOrder []string
+	}{
+		{
+			ID: testhelper.MkID("no dependencies"),
+			deps: map[string][]string{
+				"c": nil,
+				"a": nil,
+				"b": nil,
+			},
+			releases: []string{"c", "a", "b"},
+			expOrder: []string{"a", "b", "c"},
+		},
+		{
+			ID: testhelper.MkID("dependencies override the name order"),
+			deps: map[string][]string{
+				"a": {"c"},
+				"b": nil,
+				"c": {"d"},
+				"d": nil,
+			},
+			releases: []string{"a", "b", "c", "d"},
+			expOrder: []string{"d", "c", "a", "b"},
+		},
+		{
+			ID: testhelper.MkID("indirect dependency via an applied release"),
+			deps: map[string][]string{
+				"a": {"x"},
+				"x": {"b"},
+				"b": nil,
+			},
+			releases: []string{"a", "b"},
+			expOrder: []string{"b", "a"},
+		},
+		{
+			ID: testhelper.MkID("missing release"),
+			ExpErr: testhelper.MkExpErr(
+				`the release "a" requires "z" which is not` +
+					" an available or archived release"),
+			deps: map[string][]string{
+				"a": {"z"},
+			},
+			releases: []string{"a"},
+		},
+		{
+			ID: testhelper.MkID("cycle"),
+			ExpErr: testhelper.MkExpErr(
+				"there is a cycle in the release dependencies:",
+				"a -> b -> c -> a"),
+			deps: map[string][]string{
+				"a": {"b"},
+				"b": {"c"},
+				"c": {"a"},
+			},
+			releases: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tc := range testCases {
+		g := mkTestGraph(tc.deps)
+
+		err := errors.Join(g.check(tc.releases)...)
+		if testhelper.CheckExpErr(t, err, tc) && err == nil {
+			g.order(tc.releases)
+			testhelper.DiffStringSlice(t, tc.IDStr(), "order",
+				tc.releases, tc.expOrder)
+		}
+	}
+}
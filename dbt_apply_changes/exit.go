@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// exitFuncs holds the functions to be called before the program exits
+var (
+	exitMu    sync.Mutex
+	exitFuncs []func()
+)
+
+// atExit registers the function to be called by exit. The functions are
+// called in the reverse order to that in which they were registered
+func atExit(f func()) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+
+	exitFuncs = append(exitFuncs, f)
+}
+
+// exit calls the functions registered with atExit and then exits the
+// program with the given status. It should be used in place of os.Exit so
+// that any resources, such as locks, are released
+func exit(status int) {
+	exitMu.Lock()
+	funcs := exitFuncs
+	exitFuncs = nil
+	exitMu.Unlock()
+
+	for i := len(funcs) - 1; i >= 0; i-- {
+		funcs[i]()
+	}
+
+	os.Exit(status)
+}
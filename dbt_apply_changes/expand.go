@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/location.mod/location"
+)
+
+// srcLine records where a line of an SQL script came from. A zero value
+// means that the line was generated rather than read from a file
+type srcLine struct {
+	file string
+	line int64
+}
+
+// sqlScript holds SQL text to be given to psql together with the origin of
+// each line so that any errors can be reported against the original file.
+// While its step is being run the text is held in a temporary file
+type sqlScript struct {
+	text   strings.Builder
+	origin []srcLine
+	file   string
+}
+
+// addLines adds the text, which may hold several lines, to the script,
+// recording that every line came from the given source
+func (sc *sqlScript) addLines(text string, from srcLine) {
+	for line := range strings.Lines(text) {
+		sc.text.WriteString(strings.TrimSuffix(line, "\n"))
+		sc.text.WriteString("\n")
+		sc.origin = append(sc.origin, from)
+	}
+
+	if text == "" {
+		sc.text.WriteString("\n")
+		sc.origin = append(sc.origin, from)
+	}
+}
+
+// String returns the text of the script
+func (sc *sqlScript) String() string {
+	return sc.text.String()
+}
+
+// source returns the origin of the given line of the script, numbered from
+// 1. It returns false if the line was not read from a file
+func (sc *sqlScript) source(lineNo int) (srcLine, bool) {
+	if lineNo < 1 || lineNo > len(sc.origin) {
+		return srcLine{}, false
+	}
+
+	from := sc.origin[lineNo-1]
+
+	return from, from.file != ""
+}
+
+// expandSQLFile reads the SQL file, substituting any macros, and returns
+// the resulting script. If no macros were found the script is nil and the
+// file can be given to psql as it is. Any error refers to the line in the
+// SQL file where the problem was found
+func (prog *Prog) expandSQLFile(fileName string) (*sqlScript, error) {
+	f, err := os.Open(fileName) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := &sqlScript{}
+	loc := location.New(fileName)
+	changed := false
+
+	r := bufio.NewReader(f)
+
+	for {
+		text, readErr := r.ReadString('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return nil, readErr
+		}
+
+		if text == "" {
+			break
+		}
+
+		loc.Incr()
+
+		text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+
+		line, err := prog.macroCache.Substitute(text, loc)
+		if err != nil {
+			return nil, err
+		}
+
+		changed = changed || line != text
+
+		sc.addLines(line, srcLine{file: fileName, line: loc.Idx()})
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	if !changed {
+		return nil, nil
+	}
+
+	return sc, nil
+}
+
+// writeFile writes the text of the script to a temporary file in the same
+// directory as the SQL file it was made from so that any files which that
+// includes using a relative path (with \ir) are found. It returns a
+// function which will remove the file
+func (sc *sqlScript) writeFile(sqlFile string) (func(), error) {
+	f, err := os.CreateTemp(filepath.Dir(sqlFile),
+		dbtcommon.ExpandedSQLFilePrefix+"*."+filepath.Base(sqlFile))
+	if err != nil {
+		return nil, fmt.Errorf(
+			"cannot create the file for the expanded SQL of %s: %w",
+			sqlFile, err)
+	}
+
+	sc.file = f.Name()
+
+	_, err = f.WriteString(sc.String())
+	err = errors.Join(err, f.Close())
+
+	remove := func() {
+		_ = os.Remove(f.Name())
+		sc.file = ""
+	}
+
+	if err != nil {
+		remove()
+
+		return nil, fmt.Errorf(
+			"cannot write the expanded SQL of %s: %w", sqlFile, err)
+	}
+
+	return remove, nil
+}
+
+// writeScripts writes the scripts of those steps whose macros have been
+// substituted to temporary files. It returns a function which will remove
+// the files
+func (prog *Prog) writeScripts(steps ...*dbtcommon.Step) (func(), error) {
+	var removals []func()
+
+	removeAll := func() {
+		for _, remove := range removals {
+			remove()
+		}
+	}
+
+	for _, s := range steps {
+		sc := prog.scripts[s]
+		if sc == nil {
+			continue
+		}
+
+		remove, err := sc.writeFile(s.File)
+		if err != nil {
+			removeAll()
+			return nil, err
+		}
+
+		removals = append(removals, remove)
+	}
+
+	return removeAll, nil
+}
+
+// expandSQLSteps substitutes the macros in the files of all the SQL steps
+// which are to be run, including those of any hooks. It returns any
+// errors found. Nothing is done if macro substitution has been turned off
+func (prog *Prog) expandSQLSteps() []error {
+	if prog.noMacros {
+		return nil
+	}
+
+	var errs []error
+
+	prog.scripts = map[*dbtcommon.Step]*sqlScript{}
+
+	steps := slices.Concat(prog.hookSteps(dbtcommon.HookPreRelease),
+		prog.runMf.Steps,
+		prog.hookSteps(dbtcommon.HookPostRelease))
+
+	for _, s := range steps {
+		if !s.IsSQL {
+			continue
+		}
+
+		if prog.macroCache == nil {
+			mc, err := dbtcommon.NewMacroCache(prog.dbp, prog.macroDirs)
+			if err != nil {
+				return []error{
+					fmt.Errorf("cannot construct the macro cache: %w."+
+						" Give the %q parameter if the release does not"+
+						" use macros", err, paramNameNoMacros),
+				}
+			}
+
+			prog.macroCache = mc
+		}
+
+		sc, err := prog.expandSQLFile(s.File)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if sc != nil {
+			prog.scripts[s] = sc
+		}
+	}
+
+	return errs
+}
+
+// showExpandedSQL prints the SQL which will be run by each SQL step, after
+// any macros have been substituted
+func (prog *Prog) showExpandedSQL() error {
+	for i, s := range prog.runMf.Steps {
+		if !s.IsSQL {
+			continue
+		}
+
+		fmt.Printf("-- Step %d: %s\n", i+1, s.Name)
+
+		sc := prog.scripts[s]
+		if sc == nil {
+			sql, err := os.ReadFile(s.File)
+			if err != nil {
+				return err
+			}
+
+			fmt.Print(string(sql))
+
+			continue
+		}
+
+		fmt.Print(sc.String())
+	}
+
+	return nil
+}
+
+// psqlErrWriter rewrites the messages written by psql so that references
+// to lines of the temporary files holding the scripts are changed to refer
+// to the original file and line. Any messages not referring to a line of
+// one of the scripts are written unchanged
+type psqlErrWriter struct {
+	w       io.Writer
+	scripts []*sqlScript
+	buf     []byte
+}
+
+// newPsqlErrWriter returns a psqlErrWriter writing to w and using the
+// scripts to find the origin of each line. Any nil scripts are ignored
+func newPsqlErrWriter(w io.Writer, scripts ...*sqlScript) *psqlErrWriter {
+	return &psqlErrWriter{w: w, scripts: scripts}
+}
+
+// rewrite returns the line with any reference to a line of one of the
+// scripts replaced by the source of the line
+func (pw *psqlErrWriter) rewrite(line []byte) []byte {
+	for _, sc := range pw.scripts {
+		if sc == nil || sc.file == "" {
+			continue
+		}
+
+		rest, ok := bytes.CutPrefix(line, []byte("psql:"+sc.file+":"))
+		if !ok {
+			continue
+		}
+
+		num, rest, ok := bytes.Cut(rest, []byte(":"))
+		if !ok {
+			return line
+		}
+
+		lineNo, err := strconv.Atoi(string(num))
+		if err != nil {
+			return line
+		}
+
+		from, ok := sc.source(lineNo)
+		if !ok {
+			return line
+		}
+
+		return append(
+			fmt.Appendf(nil, "psql:%s:%d:", from.file, from.line),
+			rest...)
+	}
+
+	return line
+}
+
+// Write writes the complete lines in the data, rewriting them as
+// necessary. Any incomplete line is kept until the rest of the line is
+// written or Flush is called
+func (pw *psqlErrWriter) Write(data []byte) (int, error) {
+	pw.buf = append(pw.buf, data...)
+
+	for {
+		idx := bytes.IndexByte(pw.buf, '\n')
+		if idx < 0 {
+			break
+		}
+
+		if _, err := pw.w.Write(pw.rewrite(pw.buf[:idx+1])); err != nil {
+			return 0, err
+		}
+
+		pw.buf = pw.buf[idx+1:]
+	}
+
+	return len(data), nil
+}
+
+// Flush writes any remaining incomplete line
+func (pw *psqlErrWriter) Flush() {
+	if len(pw.buf) > 0 {
+		_, _ = pw.w.Write(pw.rewrite(pw.buf))
+		pw.buf = nil
+	}
+}
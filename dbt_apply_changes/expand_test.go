@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestExpandSQLFile(t *testing.T) {
+	prog := NewProg()
+	prog.dbp.BaseDirName = t.TempDir()
+
+	macroDir := dbtcommon.DbtDirMacros(prog.dbp.BaseDirName)
+	if err := os.MkdirAll(macroDir, 0o755); err != nil { //nolint:gosec
+		t.Fatal("cannot make the macro directory:", err)
+	}
+
+	err := os.WriteFile(filepath.Join(macroDir, "cols.sql"),
+		[]byte("a int,\nb int\n"), 0o644) //nolint:gosec
+	if err != nil {
+		t.Fatal("cannot make the macro file:", err)
+	}
+
+	mc, err := dbtcommon.NewMacroCache(prog.dbp, nil)
+	if err != nil {
+		t.Fatal("cannot make the macro cache:", err)
+	}
+
+	prog.macroCache = mc
+
+	// a line longer than the default limit of a bufio.Scanner
+	longText := strings.Repeat("x", 100*1024)
+
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		sql       string
+		expNo     bool
+		expSQL    string
+		expOrigin []int64
+	}{
+		{
+			ID:    testhelper.MkID("no macros"),
+			sql:   "select 1;\nselect 2;\n",
+			expNo: true,
+		},
+		{
+			ID:  testhelper.MkID("no macros, long line"),
+			sql: "select '" + longText + "';\n${cols}",
+			expSQL: "select '" + longText + "';\n" +
+				"a int,\nb int\n",
+			expOrigin: []int64{1, 2, 2},
+		},
+		{
+			ID:        testhelper.MkID("no final newline"),
+			sql:       "select 1;\r\n${cols}",
+			expSQL:    "select 1;\na int,\nb int\n",
+			expOrigin: []int64{1, 2, 2},
+		},
+		{
+			ID:        testhelper.MkID("multi-line macro"),
+			sql:       "create table t (\n${cols});\nselect 1;\n",
+			expSQL:    "create table t (\na int,\nb int\n);\nselect 1;\n",
+			expOrigin: []int64{1, 2, 2, 2, 3},
+		},
+		{
+			ID: testhelper.MkID("unknown macro"),
+			ExpErr: testhelper.MkExpErr(
+				`macro "nonesuch" at `, `:2 was not found`),
+			sql: "select 1;\nselect ${nonesuch};\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		fName := filepath.Join(prog.dbp.BaseDirName, "test.sql")
+
+		err := os.WriteFile(fName, []byte(tc.sql), 0o644) //nolint:gosec
+		if err != nil {
+			t.Fatal("cannot make the SQL file:", err)
+		}
+
+		sc, err := prog.expandSQLFile(fName)
+		if !testhelper.CheckExpErr(t, err, tc) || err != nil {
+			continue
+		}
+
+		testhelper.DiffBool(t, tc.IDStr(), "no script",
+			sc == nil, tc.expNo)
+
+		if sc == nil {
+			continue
+		}
+
+		testhelper.DiffString(t, tc.IDStr(), "SQL", sc.String(), tc.expSQL)
+
+		origin := make([]int64, 0, len(sc.origin))
+		for _, o := range sc.origin {
+			origin = append(origin, o.line)
+		}
+
+		testhelper.DiffSlice(t, tc.IDStr(), "origin", origin, tc.expOrigin)
+	}
+}
+
+func TestPsqlErrWriter(t *testing.T) {
+	const expFile = "/rel/.expanded.a.sql"
+
+	sc := &sqlScript{file: expFile}
+	sc.addLines("select 1;\nselect x;", srcLine{file: "a.sql", line: 7})
+
+	var buf bytes.Buffer
+
+	pw := newPsqlErrWriter(&buf, nil, sc)
+	_, _ = pw.Write([]byte("psql:" + expFile + ":2: ERROR:  column \"x\""))
+	_, _ = pw.Write([]byte(" does not exist\npsql:<stdin>:1: NOTICE: x\n"))
+	_, _ = pw.Write([]byte("psql:" + expFile + ":99: ERROR: y"))
+	pw.Flush()
+
+	testhelper.DiffString(t, "psqlErrWriter", "output", buf.String(),
+		"psql:a.sql:7: ERROR:  column \"x\" does not exist\n"+
+			"psql:<stdin>:1: NOTICE: x\n"+
+			"psql:"+expFile+":99: ERROR: y")
+}
+
+func TestWriteScripts(t *testing.T) {
+	sqlDir := t.TempDir()
+	expanded := &dbtcommon.Step{
+		Name:  "a.sql",
+		File:  filepath.Join(sqlDir, "a.sql"),
+		IsSQL: true,
+	}
+	unchanged := &dbtcommon.Step{
+		Name:  "b.sql",
+		File:  filepath.Join(sqlDir, "b.sql"),
+		IsSQL: true,
+	}
+
+	sc := &sqlScript{}
+	sc.addLines("select 1;", srcLine{file: expanded.File, line: 1})
+
+	prog := NewProg()
+	prog.scripts = map[*dbtcommon.Step]*sqlScript{expanded: sc}
+
+	removeScripts, err := prog.writeScripts(expanded, unchanged)
+	if err != nil {
+		t.Fatal("cannot write the scripts:", err)
+	}
+
+	testhelper.DiffString(t, "writeScripts", "directory",
+		filepath.Dir(sc.file), sqlDir)
+	testhelper.DiffBool(t, "writeScripts", "has the expanded SQL prefix",
+		strings.HasPrefix(filepath.Base(sc.file),
+			dbtcommon.ExpandedSQLFilePrefix), true)
+
+	content, err := os.ReadFile(sc.file)
+	if err != nil {
+		t.Fatal("cannot read the expanded SQL:", err)
+	}
+
+	testhelper.DiffString(t, "writeScripts", "content",
+		string(content), "select 1;\n")
+
+	cmd := prog.stepCommand(1, expanded)
+	testhelper.DiffString(t, "stepCommand", "expanded SQL file",
+		cmd.Args[len(cmd.Args)-1], sc.file)
+
+	cmd = prog.stepCommand(2, unchanged)
+	testhelper.DiffString(t, "stepCommand", "unchanged SQL file",
+		cmd.Args[len(cmd.Args)-1], unchanged.File)
+
+	fileName := sc.file
+
+	removeScripts()
+
+	_, err = os.Stat(fileName)
+	testhelper.DiffBool(t, "removeScripts", "file removed",
+		errors.Is(err, fs.ErrNotExist), true)
+	testhelper.DiffString(t, "removeScripts", "file", sc.file, "")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// noteHooks is the headline of the note describing the release hooks
+const noteHooks = "dbt_apply_changes - Hooks"
+
+// hooks holds the names of the hook files in the order they are run
+var hooks = []string{dbtcommon.HookPreRelease, dbtcommon.HookPostRelease}
+
+// hookDesc maps the names of the hook files to the description used when
+// reporting them
+var hookDesc = map[string]string{
+	dbtcommon.HookPreRelease:  "pre-release",
+	dbtcommon.HookPostRelease: "post-release",
+}
+
+// hooksNote returns the text of the note describing the release hooks
+func hooksNote() string {
+	return "Steps which must be run for every release can be given in" +
+		" hook files in the " + dbtcommon.ReleaseHooksDirName +
+		" directory in the " + dbtcommon.ReleaseScriptsBaseName +
+		" directory. The steps in the " + dbtcommon.HookPreRelease +
+		" file are run before the first step of the release and those" +
+		" in the " + dbtcommon.HookPostRelease + " file after the last" +
+		" step. This applies to rollbacks too." +
+		"\n\n" +
+		"A hook file has the same format as a " +
+		dbtcommon.ReleaseManifestFileName + " file except that the" +
+		" only directive allowed is " + dbtcommon.DirectiveInclude +
+		". The files are given relative to the directory holding the" +
+		" hook file and SQL files must be in its " +
+		dbtcommon.ReleaseSQLDirName + " directory. Hook steps are run" +
+		" just like the steps of the release but never in the release" +
+		" transaction. Executable hook steps also have " + envHook +
+		" set to the name of the hook and " + envStepNo + " set to 0." +
+		"\n\n" +
+		"A hook file in a sub-directory of the " +
+		dbtcommon.ReleaseHooksDirName + " directory named after the" +
+		" database replaces the hook file for all databases. An empty" +
+		" hook file there means that no hook is run for that database." +
+		"\n\n" +
+		"If a hook step fails then the release fails."
+}
+
+// parseHooks finds and parses the hook files to be used for the database
+// and checks that there are no unused files in the hooks directories.
+// Nothing is done if the hooks are not to be run. It returns any errors
+// found.
+func (prog *Prog) parseHooks() []error {
+	prog.hooks = map[string]*dbtcommon.Manifest{}
+
+	if prog.noHooks {
+		return nil
+	}
+
+	var errs []error
+
+	for _, hook := range hooks {
+		fileName := dbtcommon.FindHookFile(
+			prog.dbp.BaseDirName, prog.dbp.DbName, hook)
+		if fileName == "" {
+			continue
+		}
+
+		mf, hookErrs := dbtcommon.ParseHookFile(
+			prog.dbp.BaseDirName, fileName, prog.checkSums())
+		errs = append(errs, hookErrs...)
+
+		prog.hooks[hook] = mf
+	}
+
+	return append(errs, dbtcommon.CheckForUnusedHookFiles(
+		prog.dbp.BaseDirName, prog.dbp.DbName)...)
+}
+
+// hookSteps returns the steps of the named hook, if any
+func (prog *Prog) hookSteps(hook string) []*dbtcommon.Step {
+	if mf := prog.hooks[hook]; mf != nil {
+		return mf.Steps
+	}
+
+	return nil
+}
+
+// runHook runs the steps of the named hook one after another. It returns
+// an error, which names the hook, if any step fails
+func (prog *Prog) runHook(ctx context.Context, hook string) error {
+	out := prog.stdout()
+
+	for _, s := range prog.hookSteps(hook) {
+		desc := hookDesc[hook] + " hook: " + s.Name
+
+		if !prog.quiet {
+			fmt.Fprintln(out, "\t", desc)
+		}
+
+		if err := s.CheckSum(); err != nil {
+			return fmt.Errorf("the %s hook failed: %w", hookDesc[hook], err)
+		}
+
+		if err := prog.runHookStep(ctx, hook, desc, s); err != nil {
+			return fmt.Errorf("the %s hook failed: %w", hookDesc[hook], err)
+		}
+	}
+
+	return nil
+}
+
+// runHookStep runs the single step of the named hook
+func (prog *Prog) runHookStep(
+	ctx context.Context, hook, desc string, s *dbtcommon.Step,
+) error {
+	removeScripts, err := prog.writeScripts(s)
+	if err != nil {
+		return err
+	}
+	defer removeScripts()
+
+	cmd := prog.stepCommand(0, s)
+	if !s.IsSQL {
+		cmd.Env = append(cmd.Env, envHook+"="+hook)
+	}
+
+	return prog.runStepCmd(ctx, desc, s, cmd)
+}
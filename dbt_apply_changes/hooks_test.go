@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestParseHooks(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		dbName  string
+		noHooks bool
+		expPre  []string
+		expPost []string
+	}{
+		{
+			ID:      testhelper.MkID("hooks for all databases"),
+			dbName:  "prod",
+			expPre:  []string{"backup.sh"},
+			expPost: []string{"SQL.files/grants.sql"},
+		},
+		{
+			ID:     testhelper.MkID("database hook replaces the common one"),
+			dbName: "dev",
+			expPre: []string{"backup.sh"},
+		},
+		{
+			ID:      testhelper.MkID("hooks not run"),
+			dbName:  "prod",
+			noHooks: true,
+		},
+		{
+			ID: testhelper.MkID("bad hook file"),
+			ExpErr: testhelper.MkExpErr(
+				"The @transaction directive cannot be given in a"+
+					" PreRelease file",
+				"The hooks directory (",
+				`does not contain "nonesuch.sh"`),
+			dbName: "bad",
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := mkTestRelease(t, map[string]string{
+			dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n",
+			"SQL.files/a.sql":                 "select 1;\n",
+			"../Hooks/PreRelease":             "backup.sh\n",
+			"../Hooks/backup.sh":              "#!/bin/sh\n",
+			"../Hooks/PostRelease":            "SQL.files/grants.sql\n",
+			"../Hooks/SQL.files/grants.sql":   "grant;\n",
+			"../Hooks/dev/PostRelease":        "",
+			"../Hooks/bad/PreRelease":         "@transaction\nnonesuch.sh\n",
+			"../Hooks/bad/PostRelease":        "# no steps\n",
+		})
+		prog.dbp.DbName = tc.dbName
+		prog.noHooks = tc.noHooks
+
+		errs := prog.parseHooks()
+		testhelper.CheckExpErr(t, errors.Join(errs...), tc)
+
+		if len(errs) > 0 {
+			continue
+		}
+
+		for hook, exp := range map[string][]string{
+			dbtcommon.HookPreRelease:  tc.expPre,
+			dbtcommon.HookPostRelease: tc.expPost,
+		} {
+			var names []string
+			for _, s := range prog.hookSteps(hook) {
+				names = append(names, s.Name)
+			}
+
+			testhelper.DiffStringSlice(t, tc.IDStr(), hook, names, exp)
+		}
+	}
+}
+
+func TestUnusedHookFiles(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		dbName   string
+		expCount int
+	}{
+		{
+			ID: testhelper.MkID("unused file for all databases"),
+			ExpErr: testhelper.MkExpErr(
+				`contains "old.sh" which is not in any of its hook files`),
+			dbName:   "prod",
+			expCount: 1,
+		},
+		{
+			ID: testhelper.MkID("unused files for the database"),
+			ExpErr: testhelper.MkExpErr(
+				`contains "old.sh" which is not in any of its hook files`,
+				`contains "SQL.files/old.sql" which is not in any of its`),
+			dbName:   "dev",
+			expCount: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := mkTestRelease(t, map[string]string{
+			dbtcommon.ReleaseManifestFileName:   "SQL.files/a.sql\n",
+			"SQL.files/a.sql":                   "select 1;\n",
+			"../Hooks/PreRelease":               "backup.sh\n",
+			"../Hooks/backup.sh":                "#!/bin/sh\n",
+			"../Hooks/old.sh":                   "#!/bin/sh\n",
+			"../Hooks/dev/PostRelease":          "SQL.files/grants.sql\n",
+			"../Hooks/dev/SQL.files/grants.sql": "grant;\n",
+			"../Hooks/dev/SQL.files/old.sql":    "grant;\n",
+			"../Hooks/test/PreRelease":          "",
+		})
+		prog.dbp.DbName = tc.dbName
+
+		errs := prog.parseHooks()
+		testhelper.CheckExpErr(t, errors.Join(errs...), tc)
+		testhelper.DiffInt(t, tc.IDStr(), "error count", len(errs), tc.expCount)
+	}
+}
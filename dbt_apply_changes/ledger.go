@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+const (
+	dfltLedgerSchema = "dbtools"
+	ledgerTableName  = "release_ledger"
+	stepTableName    = "release_step"
+)
+
+// These are the values recorded in the outcome column of the ledger table
+const (
+	outcomeRunning         = "running"
+	outcomeSuccess         = "success"
+	outcomeFailure         = "failure"
+	outcomeRollbackRunning = "rollback-running"
+	outcomeRolledBack      = "rolled-back"
+	outcomeRollbackFailure = "rollback-failure"
+)
+
+// ledgerTable returns the schema-qualified name of the ledger table
+func (prog *Prog) ledgerTable() string {
+	return prog.ledgerSchema + "." + ledgerTableName
+}
+
+// stepTable returns the schema-qualified name of the table recording the
+// completed steps of each release
+func (prog *Prog) stepTable() string {
+	return prog.ledgerSchema + "." + stepTableName
+}
+
+// createLedger creates the ledger schema and tables if they do not already
+// exist
+func (prog *Prog) createLedger() error {
+	_, err := dbtcommon.RunSQLQuery(prog.dbp,
+		"CREATE SCHEMA IF NOT EXISTS "+prog.ledgerSchema+";\n"+
+			"CREATE TABLE IF NOT EXISTS "+prog.ledgerTable()+" (\n"+
+			"    id           BIGSERIAL PRIMARY KEY,\n"+
+			"    release_name TEXT NOT NULL,\n"+
+			"    start_time   TIMESTAMPTZ NOT NULL DEFAULT now(),\n"+
+			"    end_time     TIMESTAMPTZ,\n"+
+			"    os_user      TEXT NOT NULL,\n"+
+			"    host         TEXT NOT NULL,\n"+
+			"    tool_version TEXT NOT NULL,\n"+
+			"    outcome      TEXT NOT NULL\n"+
+			");\n"+
+			"CREATE TABLE IF NOT EXISTS "+prog.stepTable()+" (\n"+
+			"    release_name TEXT NOT NULL,\n"+
+			"    step_no      INTEGER NOT NULL,\n"+
+			"    step_file    TEXT NOT NULL,\n"+
+			"    ledger_id    BIGINT NOT NULL,\n"+
+			"    end_time     TIMESTAMPTZ NOT NULL DEFAULT now(),\n"+
+			"    PRIMARY KEY (release_name, step_no)\n"+
+			");")
+	if err != nil {
+		return fmt.Errorf("creating the release ledger (%s): %w",
+			prog.ledgerTable(), err)
+	}
+
+	return nil
+}
+
+// releaseStatus returns the outcome of the most recent successful
+// application or rollback of the named release. It returns an empty string
+// if the release has never been successfully applied or rolled back
+func (prog *Prog) releaseStatus(relName string) (string, error) {
+	rows, err := dbtcommon.RunSQLQuery(prog.dbp,
+		"SELECT outcome FROM "+prog.ledgerTable()+
+			" WHERE release_name = "+dbtcommon.QuoteLiteral(relName)+
+			" AND outcome IN ("+
+			dbtcommon.QuoteLiteral(outcomeSuccess)+", "+
+			dbtcommon.QuoteLiteral(outcomeRolledBack)+")"+
+			" ORDER BY id DESC LIMIT 1")
+	if err != nil {
+		return "", fmt.Errorf(
+			"checking the release ledger for %q: %w", relName, err)
+	}
+
+	if len(rows) == 0 {
+		return "", nil
+	}
+
+	return rows[0][0], nil
+}
+
+// ledgerRecord holds the outcome of the most recent successful
+// application or rollback of a release and when it finished
+type ledgerRecord struct {
+	outcome string
+	endTime string
+}
+
+// ledgerExists returns true if the ledger table exists. This allows the
+// ledger to be read without creating it
+func (prog *Prog) ledgerExists() (bool, error) {
+	val, err := dbtcommon.RunSQLSingleValue(prog.dbp,
+		"SELECT to_regclass("+dbtcommon.QuoteLiteral(prog.ledgerTable())+
+			") IS NOT NULL")
+	if err != nil {
+		return false, fmt.Errorf("checking for the release ledger (%s): %w",
+			prog.ledgerTable(), err)
+	}
+
+	return val == "t", nil
+}
+
+// releaseRecords returns the outcome and end time of the most recent
+// successful application or rollback of every release in the ledger,
+// keyed by release name. The end time is given in UTC in RFC 3339 format
+func (prog *Prog) releaseRecords() (map[string]ledgerRecord, error) {
+	records := map[string]ledgerRecord{}
+
+	exists, err := prog.ledgerExists()
+	if err != nil || !exists {
+		return records, err
+	}
+
+	rows, err := dbtcommon.RunSQLQuery(prog.dbp,
+		"SELECT DISTINCT ON (release_name) release_name, outcome,"+
+			" to_char(end_time AT TIME ZONE 'UTC',"+
+			` 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`+
+			" FROM "+prog.ledgerTable()+
+			" WHERE outcome IN ("+
+			dbtcommon.QuoteLiteral(outcomeSuccess)+", "+
+			dbtcommon.QuoteLiteral(outcomeRolledBack)+")"+
+			" ORDER BY release_name, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("reading the release ledger (%s): %w",
+			prog.ledgerTable(), err)
+	}
+
+	for _, row := range rows {
+		const expectedFields = 3
+		if len(row) != expectedFields {
+			return nil, fmt.Errorf("bad release ledger record: %q", row)
+		}
+
+		records[row[0]] = ledgerRecord{outcome: row[1], endTime: row[2]}
+	}
+
+	return records, nil
+}
+
+// releaseIsApplied returns true if the ledger records the named release as
+// having been successfully applied and not subsequently rolled back
+func (prog *Prog) releaseIsApplied(relName string) (bool, error) {
+	status, err := prog.releaseStatus(relName)
+
+	return status == outcomeSuccess, err
+}
+
+// checkCanApply returns an error if the release has already been
+// successfully applied unless the reapply flag has been set. If the release
+// is being rolled back it instead checks that it has not already been
+// rolled back and warns if there is no record of it having been applied.
+func (prog *Prog) checkCanApply() error {
+	if err := prog.createLedger(); err != nil {
+		return err
+	}
+
+	status, err := prog.releaseStatus(prog.releaseName)
+	if err != nil {
+		return err
+	}
+
+	if prog.rollback {
+		switch status {
+		case outcomeRolledBack:
+			return fmt.Errorf(
+				"the release %q has already been rolled back",
+				prog.releaseName)
+		case "":
+			fmt.Fprintf(prog.screen(),
+				"Warning: the release ledger (%s) has no record"+
+					" of %q being applied\n",
+				prog.ledgerTable(), prog.releaseName)
+		}
+
+		return nil
+	}
+
+	if status == outcomeSuccess && !prog.reapply {
+		return fmt.Errorf(
+			"the release %q has already been applied to the database."+
+				" Give the %q parameter to apply it again",
+			prog.releaseName, paramNameReapply)
+	}
+
+	return nil
+}
+
+// releaseDone returns true if there is nothing to do because the release
+// has already been applied to the database or, if it is being rolled back,
+// it has already been rolled back. A release which is to be reapplied is
+// never done
+func (prog *Prog) releaseDone() (bool, error) {
+	if err := prog.createLedger(); err != nil {
+		return false, err
+	}
+
+	status, err := prog.releaseStatus(prog.releaseName)
+	if err != nil {
+		return false, err
+	}
+
+	if prog.rollback {
+		return status == outcomeRolledBack, nil
+	}
+
+	return status == outcomeSuccess && !prog.reapply, nil
+}
+
+// osUserName returns the name of the user running the program
+func osUserName() string {
+	u, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+
+	return u.Username
+}
+
+// hostName returns the name of the host the program is running on
+func hostName() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+
+	return h
+}
+
+// ledgerStart adds a new entry to the ledger table recording the start of
+// the application (or rollback) of the release with the given outcome and
+// returns the id of the new entry
+func (prog *Prog) ledgerStart(outcome string) (int64, error) {
+	val, err := dbtcommon.RunSQLSingleValue(prog.dbp,
+		"INSERT INTO "+prog.ledgerTable()+
+			" (release_name, os_user, host, tool_version, outcome)"+
+			" VALUES ("+
+			dbtcommon.QuoteLiteral(prog.releaseName)+", "+
+			dbtcommon.QuoteLiteral(osUserName())+", "+
+			dbtcommon.QuoteLiteral(hostName())+", "+
+			dbtcommon.QuoteLiteral(dbtcommon.ToolVersion())+", "+
+			dbtcommon.QuoteLiteral(outcome)+
+			") RETURNING id")
+	if err != nil {
+		return 0, fmt.Errorf("recording the release start in the ledger: %w",
+			err)
+	}
+
+	id, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad ledger id (%q): %w", val, err)
+	}
+
+	return id, nil
+}
+
+// ledgerEnd records the end time and the outcome of the release in the
+// ledger entry with the given id
+func (prog *Prog) ledgerEnd(id int64, outcome string) error {
+	_, err := dbtcommon.RunSQLQuery(prog.dbp,
+		"UPDATE "+prog.ledgerTable()+
+			" SET end_time = now(), outcome = "+
+			dbtcommon.QuoteLiteral(outcome)+
+			" WHERE id = "+strconv.FormatInt(id, 10))
+	if err != nil {
+		return fmt.Errorf("recording the release outcome in the ledger: %w",
+			err)
+	}
+
+	return nil
+}
+
+// completedSteps returns the steps of the release that the step table
+// records as having been completed, in step order
+func (prog *Prog) completedSteps() ([]completedStep, error) {
+	rows, err := dbtcommon.RunSQLQuery(prog.dbp,
+		"SELECT step_no, step_file FROM "+prog.stepTable()+
+			" WHERE release_name = "+dbtcommon.QuoteLiteral(prog.releaseName)+
+			" ORDER BY step_no")
+	if err != nil {
+		return nil, fmt.Errorf("reading the completed steps of %q: %w",
+			prog.releaseName, err)
+	}
+
+	steps := make([]completedStep, 0, len(rows))
+
+	for _, row := range rows {
+		const expectedFields = 2
+		if len(row) != expectedFields {
+			return nil, fmt.Errorf("bad completed step record: %q", row)
+		}
+
+		stepNo, err := strconv.Atoi(row[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad completed step number (%q): %w",
+				row[0], err)
+		}
+
+		steps = append(steps, completedStep{stepNo: stepNo, file: row[1]})
+	}
+
+	return steps, nil
+}
+
+// clearSteps removes any record of completed steps for the release
+func (prog *Prog) clearSteps() error {
+	_, err := dbtcommon.RunSQLQuery(prog.dbp,
+		"DELETE FROM "+prog.stepTable()+
+			" WHERE release_name = "+dbtcommon.QuoteLiteral(prog.releaseName))
+	if err != nil {
+		return fmt.Errorf("clearing the completed steps of %q: %w",
+			prog.releaseName, err)
+	}
+
+	return nil
+}
+
+// recordStep records the completion of the step with the given number
+// (counting from 1) and the given file name (relative to the release
+// directory)
+func (prog *Prog) recordStep(stepNo int, file string) error {
+	_, err := dbtcommon.RunSQLQuery(prog.dbp,
+		"INSERT INTO "+prog.stepTable()+
+			" (release_name, step_no, step_file, ledger_id)"+
+			" VALUES ("+
+			dbtcommon.QuoteLiteral(prog.releaseName)+", "+
+			strconv.Itoa(stepNo)+", "+
+			dbtcommon.QuoteLiteral(file)+", "+
+			strconv.FormatInt(prog.ledgerID, 10)+")")
+	if err != nil {
+		return fmt.Errorf("recording the completion of step %d (%s): %w",
+			stepNo, file, err)
+	}
+
+	return nil
+}
+
+// stepDone records the completion of the step so that the release can be
+// resumed after a failure. Nothing is recorded when the release is being
+// rolled back
+func (prog *Prog) stepDone(stepNo int, file string) error {
+	if prog.rollback {
+		return nil
+	}
+
+	return prog.recordStep(stepNo, file)
+}
+
+// applyAndRecord applies the release, recording the start and end of the
+// application in the ledger table
+func (prog *Prog) applyAndRecord(ctx context.Context) error {
+	prog.running.setApplying(true)
+	defer prog.running.setApplying(false)
+
+	if prog.rollback {
+		return prog.rollbackAndRecord(ctx)
+	}
+
+	if !prog.resume {
+		if err := prog.clearSteps(); err != nil {
+			return err
+		}
+	}
+
+	id, err := prog.ledgerStart(outcomeRunning)
+	if err != nil {
+		return err
+	}
+
+	prog.ledgerID = id
+
+	outcome := outcomeSuccess
+
+	applyErr := prog.applyRelease(ctx)
+	if applyErr != nil {
+		outcome = outcomeFailure
+	}
+
+	return errors.Join(applyErr, prog.ledgerEnd(id, outcome))
+}
+
+// rollbackAndRecord runs the steps in the rollback manifest, recording the
+// start and end of the rollback in the ledger table. Once the rollback has
+// succeeded any record of completed steps is removed so that a subsequent
+// application of the release starts from the beginning
+func (prog *Prog) rollbackAndRecord(ctx context.Context) error {
+	id, err := prog.ledgerStart(outcomeRollbackRunning)
+	if err != nil {
+		return err
+	}
+
+	prog.ledgerID = id
+
+	outcome := outcomeRolledBack
+
+	rbErr := prog.applyRelease(ctx)
+	if rbErr != nil {
+		outcome = outcomeRollbackFailure
+	}
+
+	errs := []error{rbErr, prog.ledgerEnd(id, outcome)}
+	if rbErr == nil {
+		errs = append(errs, prog.clearSteps())
+	}
+
+	return errors.Join(errs...)
+}
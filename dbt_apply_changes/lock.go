@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// noteLocking is the headline of the note describing the release locks
+const noteLocking = "dbt_apply_changes - Locking"
+
+const (
+	// lockRetryInterval is how long to wait between attempts to take the
+	// release locks
+	lockRetryInterval = time.Second
+	// lockKeySpace is hashed to give the first key of the advisory lock
+	// so that it is unlikely to clash with any lock taken by other
+	// applications
+	lockKeySpace = "dbtools"
+	// lockReplyTimeout is the shortest time to wait for the database
+	// session to reply when taking the database lock
+	lockReplyTimeout = 30 * time.Second
+)
+
+// lockingNote returns the text of the note describing the release locks
+func lockingNote() string {
+	return "While releases are being applied or rolled back two locks are" +
+		" held so that no-one else can change the same database at the" +
+		" same time. The first is a file lock on a file in the " +
+		dbtcommon.ReleaseScriptsBaseName + " directory named after the" +
+		" database; this prevents concurrent releases from the same" +
+		" directory even if the database cannot be reached. The second" +
+		" is a PostgreSQL advisory lock held by a database session which" +
+		" lasts as long as the program runs; this prevents concurrent" +
+		" releases from different machines. The advisory lock is" +
+		" identified by the schema of the release ledger." +
+		"\n\n" +
+		"If either lock is held by someone else the details of who holds" +
+		" it are reported. By default the program then exits but you can" +
+		" wait for the lock to be released by giving the " +
+		paramNameLockWait + " parameter." +
+		"\n\n" +
+		"If the database session does not reply when the advisory lock" +
+		" is requested the program gives up after " +
+		lockReplyTimeout.String() + ", or the " + paramNameLockWait +
+		" time if that is longer, and the session is stopped." +
+		"\n\n" +
+		"No locks are taken if the releases are only being shown or" +
+		" checked."
+}
+
+// lockBusyError records that a release lock is held by someone else
+type lockBusyError struct {
+	lock   string
+	holder string
+}
+
+// Error returns a description of the lock and who holds it
+func (e lockBusyError) Error() string {
+	if e.holder == "" {
+		return fmt.Sprintf("the %s is held by someone else", e.lock)
+	}
+
+	return fmt.Sprintf("the %s is held by %s", e.lock, e.holder)
+}
+
+// releaseLock holds the locks taken to prevent concurrent releases against
+// a database
+type releaseLock struct {
+	file *os.File
+
+	session *exec.Cmd
+	stdin   io.WriteCloser
+
+	once sync.Once
+}
+
+// release releases the locks. It is safe to call it more than once
+func (l *releaseLock) release() {
+	if l == nil {
+		return
+	}
+
+	l.once.Do(func() {
+		if l.stdin != nil {
+			_ = l.stdin.Close()
+			_ = l.session.Wait()
+		}
+
+		if l.file != nil {
+			_ = l.file.Truncate(0)
+			_ = l.file.Close()
+		}
+	})
+}
+
+// lockKey hashes the string to give a key for the advisory lock. The key
+// is never negative so that it matches the value shown in pg_locks
+func lockKey(s string) int32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+
+	return int32(h.Sum32() & 0x7fffffff) //nolint:gosec
+}
+
+// lockKeys returns the keys of the advisory lock for the release ledger
+func (prog *Prog) lockKeys() (int32, int32) {
+	return lockKey(lockKeySpace), lockKey(prog.ledgerSchema)
+}
+
+// lockHolderInfo returns a description of this program which is recorded
+// with the locks so that anyone else wanting them can find who holds them
+func lockHolderInfo() string {
+	return fmt.Sprintf("%s@%s (pid %d)", osUserName(), hostName(), os.Getpid())
+}
+
+// lockFileName returns the name of the file to be locked
+func (prog *Prog) lockFileName() string {
+	return dbtcommon.DbtFileReleaseLock(prog.dbp.BaseDirName, prog.dbp.DbName)
+}
+
+// lockFile takes the file lock. If it is held by someone else a
+// lockBusyError is returned, reporting the details recorded in the file by
+// the holder of the lock
+func (prog *Prog) lockFile() (*os.File, error) {
+	name := prog.lockFileName()
+
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("opening the lock file: %w", err)
+	}
+
+	ok, err := tryLockFile(f)
+	if err != nil {
+		_ = f.Close()
+
+		return nil, fmt.Errorf("locking %q: %w", name, err)
+	}
+
+	if !ok {
+		holder, _ := io.ReadAll(f)
+		_ = f.Close()
+
+		return nil, lockBusyError{
+			lock:   fmt.Sprintf("lock file (%s)", name),
+			holder: strings.TrimSpace(string(holder)),
+		}
+	}
+
+	info := lockHolderInfo() + " since " + time.Now().Format(time.RFC3339)
+
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(info+"\n"), 0)
+	}
+
+	return f, nil
+}
+
+// lockReply holds the reply from the database session to the request for
+// the advisory lock
+type lockReply struct {
+	text string
+	err  error
+}
+
+// readLockReply reads the reply to the request for the advisory lock from
+// the database session. It gives up if there is no reply before the
+// timeout or the context is cancelled, in which case the session, and any
+// processes it has started, are killed
+func readLockReply(
+	ctx context.Context, cmd *exec.Cmd, stdout io.Reader, timeout time.Duration,
+) (string, error) {
+	replies := make(chan lockReply, 1)
+
+	go func() {
+		text, err := bufio.NewReader(stdout).ReadString('\n')
+		replies <- lockReply{text: text, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-replies:
+		return r.text, r.err
+	case <-timer.C:
+		signalProcGroup(cmd.Process, syscall.SIGKILL)
+
+		return "", fmt.Errorf("there was no reply from the database"+
+			" session after %s", timeout)
+	case <-ctx.Done():
+		signalProcGroup(cmd.Process, syscall.SIGKILL)
+
+		return "", context.Cause(ctx)
+	}
+}
+
+// lockDB starts a database session and takes the advisory lock in it. The
+// lock is held until the session's standard input is closed. If the lock
+// is held by someone else a lockBusyError is returned, reporting the
+// details of the session holding it. If the session does not reply within
+// the timeout or the context is cancelled, the session is killed and an
+// error is returned
+func (prog *Prog) lockDB(
+	ctx context.Context, timeout time.Duration,
+) (*exec.Cmd, io.WriteCloser, error) {
+	cmd := dbtcommon.SQLSessionCommand(prog.dbp)
+	cmd.Env = append(os.Environ(),
+		"PGAPPNAME=dbt_apply_changes: "+lockHolderInfo())
+	// the session is run in its own process group so that an interrupt
+	// from the terminal doesn't end it, releasing the lock, while the
+	// release is being stopped
+	setProcGroup(cmd)
+	cmd.WaitDelay = killDelay
+
+	var stderr bytes.Buffer
+
+	cmd.Stderr = &stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("starting the lock session: %w", err)
+	}
+
+	k1, k2 := prog.lockKeys()
+	_, err = fmt.Fprintf(stdin,
+		"SELECT pg_try_advisory_lock(%d, %d);\n", k1, k2)
+
+	reply := ""
+	if err == nil {
+		reply, err = readLockReply(ctx, cmd, stdout, timeout)
+	}
+
+	if reply == "t\n" {
+		return cmd, stdin, nil
+	}
+
+	_ = stdin.Close()
+	waitErr := cmd.Wait()
+
+	if err == nil && reply == "f\n" {
+		return nil, nil, lockBusyError{
+			lock:   "database lock",
+			holder: prog.dbLockHolder(),
+		}
+	}
+
+	if ctxErr := context.Cause(ctx); ctxErr != nil && errors.Is(err, ctxErr) {
+		return nil, nil, err
+	}
+
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return nil, nil, fmt.Errorf("taking the database lock: %s", msg)
+	}
+
+	if err == nil || errors.Is(err, io.EOF) {
+		err = waitErr
+	}
+
+	if err == nil {
+		err = fmt.Errorf("unexpected reply: %q", reply)
+	}
+
+	return nil, nil, fmt.Errorf("taking the database lock: %w", err)
+}
+
+// dbLockHolder returns a description of the database session holding the
+// advisory lock. An empty string is returned if this cannot be found
+func (prog *Prog) dbLockHolder() string {
+	k1, k2 := prog.lockKeys()
+
+	rows, err := dbtcommon.RunSQLQuery(prog.dbp,
+		"SELECT a.usename, a.application_name,"+
+			" COALESCE(host(a.client_addr), 'local'), a.backend_start"+
+			" FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid"+
+			" WHERE l.locktype = 'advisory' AND l.granted"+
+			fmt.Sprintf(" AND l.classid = %d AND l.objid = %d", k1, k2)+
+			" AND l.objsubid = 2")
+	if err != nil || len(rows) != 1 || len(rows[0]) != 4 {
+		return ""
+	}
+
+	r := rows[0]
+
+	return fmt.Sprintf("database user %s (%s) connected from %s since %s",
+		r[0], r[1], r[2], r[3])
+}
+
+// tryLock takes the file lock and then the database lock. If either cannot
+// be taken any lock already taken is released and the error is returned.
+// The database session is given the timeout to reply
+func (prog *Prog) tryLock(
+	ctx context.Context, timeout time.Duration,
+) (*releaseLock, error) {
+	f, err := prog.lockFile()
+	if err != nil {
+		return nil, err
+	}
+
+	session, stdin, err := prog.lockDB(ctx, timeout)
+	if err != nil {
+		_ = f.Truncate(0)
+		_ = f.Close()
+
+		return nil, err
+	}
+
+	return &releaseLock{file: f, session: session, stdin: stdin}, nil
+}
+
+// lockDatabase takes the locks which prevent anyone else from applying
+// releases to the database at the same time. If the locks are held by
+// someone else it will keep trying until the lock-wait time has passed or
+// the context is cancelled. The database session is given at least the
+// lock-wait time to reply. The locks are released when the returned
+// releaseLock's release method is called or the program exits.
+func (prog *Prog) lockDatabase(ctx context.Context) (*releaseLock, error) {
+	deadline := time.Now().Add(prog.lockWait)
+	waiting := false
+
+	for {
+		l, err := prog.tryLock(ctx,
+			max(lockReplyTimeout, time.Until(deadline)))
+		if err == nil {
+			atExit(l.release)
+
+			return l, nil
+		}
+
+		if ctxErr := context.Cause(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		var busy lockBusyError
+		if !errors.As(err, &busy) {
+			return nil, fmt.Errorf("cannot lock the database: %w", err)
+		}
+
+		if !time.Now().Before(deadline) {
+			if waiting {
+				return nil, fmt.Errorf("cannot lock the database,"+
+					" gave up after waiting %s: %w", prog.lockWait, err)
+			}
+
+			return nil, fmt.Errorf("cannot lock the database: %w."+
+				" Give the %q parameter to wait for it",
+				err, paramNameLockWait)
+		}
+
+		if !waiting && !prog.quiet {
+			fmt.Fprintf(prog.screen(),
+				"Waiting up to %s for the lock: %s\n", prog.lockWait, err)
+		}
+
+		waiting = true
+
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,183 @@
+//go:build unix && !aix && !solaris
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+// fakeLockPsql is a script standing in for psql. It reports a holder of
+// the lock when asked and otherwise gives the reply set in the environment
+// to the first line of SQL it reads. If the reply is "hang" it never
+// replies
+const fakeLockPsql = `#!/bin/sh
+case "$*" in
+*pg_locks*)
+	printf 'alice\tdbt_apply_changes: alice@elsewhere\tlocal\t2026-10-18\n'
+	exit 0;;
+esac
+if [ "$FAKE_LOCK_REPLY" = "error" ]
+then
+	echo "psql: error: connection refused" >&2
+	exit 2
+fi
+read q
+if [ "$FAKE_LOCK_REPLY" = "hang" ]
+then
+	sleep 60
+fi
+echo "$FAKE_LOCK_REPLY"
+cat > /dev/null
+`
+
+// mkLockTestProg returns a Prog set up to use the fake psql
+func mkLockTestProg(t *testing.T) *Prog {
+	t.Helper()
+
+	prog := mkTestRelease(t, map[string]string{
+		dbtcommon.ReleaseManifestFileName: "",
+	})
+	prog.quiet = true
+	prog.dbp.DbName = "prod"
+
+	prog.dbp.PsqlPath = filepath.Join(t.TempDir(), "psql")
+
+	err := os.WriteFile(prog.dbp.PsqlPath, //nolint:gosec
+		[]byte(fakeLockPsql), 0o755)
+	if err != nil {
+		t.Fatal("cannot write the fake psql:", err)
+	}
+
+	return prog
+}
+
+type expErr struct {
+	testhelper.ID
+	testhelper.ExpErr
+}
+
+func TestLockDatabase(t *testing.T) {
+	prog := mkLockTestProg(t)
+
+	ctx := context.Background()
+
+	t.Setenv("FAKE_LOCK_REPLY", "t")
+
+	lock, err := prog.lockDatabase(ctx)
+	testhelper.CheckExpErr(t, err, expErr{ID: testhelper.MkID("lock free")})
+
+	holder, err := os.ReadFile(prog.lockFileName())
+	if err != nil {
+		t.Fatal("cannot read the lock file:", err)
+	}
+
+	if !strings.HasPrefix(string(holder), lockHolderInfo()+" since ") {
+		t.Error("the lock file should name the holder of the lock,"+
+			" it holds:", string(holder))
+	}
+
+	_, err = prog.lockDatabase(ctx)
+	testhelper.CheckExpErr(t, err,
+		expErr{
+			ID: testhelper.MkID("lock file held"),
+			ExpErr: testhelper.MkExpErr(
+				"cannot lock the database: the lock file (",
+				"is held by "+lockHolderInfo()+" since ",
+				`Give the "`+paramNameLockWait+`" parameter`),
+		})
+
+	lock.release()
+	lock.release()
+
+	t.Setenv("FAKE_LOCK_REPLY", "f")
+
+	_, err = prog.lockDatabase(ctx)
+	testhelper.CheckExpErr(t, err,
+		expErr{
+			ID: testhelper.MkID("database lock held"),
+			ExpErr: testhelper.MkExpErr(
+				"the database lock is held by database user alice" +
+					" (dbt_apply_changes: alice@elsewhere)" +
+					" connected from local since 2026-10-18"),
+		})
+
+	prog.lockWait = 1500 * time.Millisecond
+
+	_, err = prog.lockDatabase(ctx)
+	testhelper.CheckExpErr(t, err,
+		expErr{
+			ID: testhelper.MkID("database lock held, waited"),
+			ExpErr: testhelper.MkExpErr(
+				"gave up after waiting 1.5s",
+				"the database lock is held by database user alice"),
+		})
+
+	prog.lockWait = 0
+
+	t.Setenv("FAKE_LOCK_REPLY", "error")
+
+	_, err = prog.lockDatabase(ctx)
+	testhelper.CheckExpErr(t, err,
+		expErr{
+			ID: testhelper.MkID("database not available"),
+			ExpErr: testhelper.MkExpErr(
+				"taking the database lock:" +
+					" psql: error: connection refused"),
+		})
+
+	t.Setenv("FAKE_LOCK_REPLY", "t")
+
+	lock, err = prog.lockDatabase(ctx)
+	testhelper.CheckExpErr(t, err,
+		expErr{ID: testhelper.MkID("lock free again")})
+	lock.release()
+}
+
+func TestLockDatabaseNoReply(t *testing.T) {
+	prog := mkLockTestProg(t)
+
+	t.Setenv("FAKE_LOCK_REPLY", "hang")
+
+	const timeout = 200 * time.Millisecond
+
+	start := time.Now()
+
+	_, _, err := prog.lockDB(context.Background(), timeout)
+	testhelper.CheckExpErr(t, err,
+		expErr{
+			ID: testhelper.MkID("no reply"),
+			ExpErr: testhelper.MkExpErr(
+				"taking the database lock:" +
+					" there was no reply from the database session" +
+					" after 200ms"),
+		})
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err = prog.lockDatabase(ctx)
+	testhelper.CheckExpErr(t, err,
+		expErr{
+			ID:     testhelper.MkID("no reply, interrupted"),
+			ExpErr: testhelper.MkExpErr(context.DeadlineExceeded.Error()),
+		})
+
+	if d := time.Since(start); d > 10*time.Second {
+		t.Error("the hung session should have been killed, took:", d)
+	}
+
+	t.Setenv("FAKE_LOCK_REPLY", "t")
+
+	lock, err := prog.lockDatabase(context.Background())
+	testhelper.CheckExpErr(t, err,
+		expErr{ID: testhelper.MkID("lock file released after no reply")})
+	lock.release()
+}
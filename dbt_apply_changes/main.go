@@ -3,16 +3,19 @@ package main
 // dbt_apply_changes
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/nickwells/cli.mod/cli/responder"
 	"github.com/nickwells/dbtools/internal/dbtcommon"
-	"github.com/nickwells/location.mod/location"
+	"github.com/nickwells/macros.mod/macros"
 )
 
 // Created: Wed Apr 12 21:29:46 2017
@@ -27,97 +30,115 @@ const (
 
 const errorPrefix = "*** Error ***"
 
-// reportErrors checks if there are any errors and if so prints them and exits
+// reportErrors checks if there are any errors and if so prints them and
+// exits. Any nil errors are ignored. The exit status shows if a step timed
+// out or the program was interrupted
 func reportErrors(errors ...error) {
-	if len(errors) == 0 {
-		return
-	}
+	errCount := 0
+	status := errorExitStatus(errors...)
 
 	for _, err := range errors {
 		if err != nil {
 			fmt.Println(errorPrefix, err)
+
+			errCount++
 		}
 	}
 
-	os.Exit(1)
+	if errCount > 0 {
+		exit(status)
+	}
+}
+
+// These are the titles and separators used when showing the ReadMe and
+// Warning files
+const (
+	readMeTitle  = "Note"
+	readMeSep    = "========================================\n"
+	warningTitle = "Warning"
+	warningSep   = "#################################################\n"
+)
+
+// printFileHeader prints the header for the printBlock func below
+func printFileHeader(w io.Writer, title, sep string) {
+	fmt.Fprintln(w)
+	fmt.Fprint(w, sep)
+	fmt.Fprintf(w, "\t\t%s\n", title)
+	fmt.Fprint(w, sep)
+}
+
+// printBlock prints the text between a header and a closing separator. It
+// prints nothing if the text is empty. It returns true if the text was
+// printed
+func printBlock(w io.Writer, text, title, sep string) bool {
+	if text == "" {
+		return false
+	}
+
+	printFileHeader(w, title, sep)
+	fmt.Fprint(w, text)
+
+	if !strings.HasSuffix(text, "\n") {
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprint(w, sep)
+	fmt.Fprintln(w)
+
+	return true
 }
 
-// printFileHeader prints the header for the printFile func below
-func printFileHeader(title, sep string) {
-	fmt.Println()
-	fmt.Print(sep)
-	fmt.Printf("\t\t%s\n", title)
-	fmt.Print(sep)
+// printAcceptWarning prints the parameter to be given to accept the
+// Warning file with the given checksum without being asked
+func printAcceptWarning(w io.Writer, sum string) {
+	fmt.Fprintf(w, "\nTo accept this warning without being asked,"+
+		" give the parameter: -%s=%s\n\n", paramNameAcceptWarn, sum)
 }
 
 // printAlert prints a message with a surrounding alert box
-func printAlert(msg string) action {
+func printAlert(w io.Writer, msg string) action {
 	const boxWidth = 40
 
 	box := strings.Repeat("*", boxWidth)
 
-	fmt.Println(box)
-	fmt.Println("* " + errorPrefix)
-	fmt.Println("* " + msg)
-	fmt.Println(box)
+	fmt.Fprintln(w, box)
+	fmt.Fprintln(w, "* "+errorPrefix)
+	fmt.Fprintln(w, "* "+msg)
+	fmt.Fprintln(w, box)
 
 	return abort
 }
 
 // printFile prints the file if it exists and is not empty and returns a
 // value indicating what to do next
-func printFile(fileName, title, sep string) action {
-	nextAction := doNothing
-
+func printFile(w io.Writer, fileName, title, sep string) action {
 	fStat, err := os.Stat(fileName)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nextAction
+			return doNothing
 		}
 
-		return printAlert(
+		return printAlert(w,
 			fmt.Sprintf("Couldn't open the file: %q: %s", fileName, err))
 	}
 
 	if !fStat.Mode().IsRegular() {
-		return printAlert(
+		return printAlert(w,
 			fmt.Sprintf("%q exists but it is not a regular file",
 				fileName))
 	}
 
-	fd, err := os.Open(fileName) //nolint:gosec
+	content, err := os.ReadFile(fileName) //nolint:gosec
 	if err != nil {
-		return printAlert(
-			fmt.Sprintf("Couldn't open %q: %s\n", fileName, err))
-	}
-
-	defer fd.Close()
-
-	scanner := bufio.NewScanner(fd)
-	for scanner.Scan() {
-		if nextAction == doNothing {
-			printFileHeader(title, sep)
-
-			nextAction = confirm
-		}
-
-		line := scanner.Text()
-
-		fmt.Println(line)
+		return printAlert(w,
+			fmt.Sprintf("Couldn't read %q: %s\n", fileName, err))
 	}
 
-	if err = scanner.Err(); err != nil {
-		return printAlert(
-			fmt.Sprintf("%s While reading %q: %s\n",
-				errorPrefix, fileName, err))
+	if printBlock(w, string(content), title, sep) {
+		return confirm
 	}
 
-	if nextAction == confirm {
-		fmt.Print(sep)
-		fmt.Println()
-	}
-
-	return nextAction
+	return doNothing
 }
 
 // showReadMe prints the ReadMe file if any unless the quiet flag has been set
@@ -126,13 +147,16 @@ func (prog *Prog) showReadMe() {
 		return
 	}
 
-	printFile(dbtcommon.DbtFileReleaseReadMe(
+	printFile(prog.stdout(), dbtcommon.DbtFileReleaseReadMe(
 		prog.dbp.BaseDirName, prog.releaseName),
-		"Note", "========================================\n")
+		readMeTitle, readMeSep)
 }
 
 // showWarning prints the Warnings file (if any) unless the noWarn flag has
-// been set
+// been set. If the checksum of the file is one of those which have been
+// accepted the release proceeds, if checksums have been accepted but this
+// is not one of them the program exits, otherwise the user is asked to
+// confirm that the release should proceed.
 func (prog *Prog) showWarning() {
 	if prog.noWarn {
 		return
@@ -148,18 +172,63 @@ func (prog *Prog) showWarning() {
 		},
 		responder.SetMaxReprompts(repromptCount))
 
-	switch printFile(
-		dbtcommon.DbtFileReleaseWarning(prog.dbp.BaseDirName, prog.releaseName),
-		"Warning", "#################################################\n") {
+	warnFile := dbtcommon.DbtFileReleaseWarning(
+		prog.dbp.BaseDirName, prog.releaseName)
+
+	out := prog.stdout()
+
+	switch printFile(out, warnFile, warningTitle, warningSep) {
 	case confirm:
-		if r.GetResponseOrDie() == 'y' {
+		sum, err := dbtcommon.FileSHA256(warnFile)
+		if err != nil {
+			prog.closeTranscript([]error{
+				fmt.Errorf("calculating the checksum of the %s file: %w",
+					dbtcommon.ReleaseWarningFileName, err),
+			})
+			exit(1)
+		}
+
+		if len(prog.acceptWarning) > 0 {
+			if slices.Contains(prog.acceptWarning, sum) {
+				fmt.Fprintf(out, "\nThe %s has been accepted (%s=%s)\n\n",
+					dbtcommon.ReleaseWarningFileName, paramNameAcceptWarn, sum)
+				return
+			}
+
+			err := fmt.Errorf("the checksum of the %s file (%s)"+
+				" is not one of the accepted values;"+
+				" it may have changed since it was accepted",
+				dbtcommon.ReleaseWarningFileName, sum)
+			fmt.Println()
+			fmt.Println(errorPrefix, err)
+			prog.closeTranscript([]error{err})
+			exit(1)
+		}
+
+		printAcceptWarning(out, sum)
+
+		resp, err := r.GetResponse()
+		if err != nil {
+			fmt.Println()
+			fmt.Println(errorPrefix, err)
+			prog.closeTranscript([]error{err})
+			exit(1)
+		}
+
+		prog.transcript.printf("Do you want to continue? response: %c\n",
+			resp)
+
+		if resp == 'y' {
 			fmt.Println()
 			return
 		}
 
-		fallthrough
+		prog.closeTranscript([]error{errors.New("the release was aborted")})
+		exit(1)
 	case abort:
-		os.Exit(1)
+		prog.closeTranscript(
+			[]error{errors.New("the Warning file could not be shown")})
+		exit(1)
 	}
 }
 
@@ -171,50 +240,160 @@ func (prog *Prog) checkReleaseDir() {
 		fmt.Printf("%s Bad release: %s\n", errorPrefix, prog.releaseName)
 		fmt.Printf("\t%s\n", err)
 		prog.showReleases("\t", "\t\t")
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 // applyRelease runs each of the files in the manifest in the specified
-// order. If the file is in the SQL directory then it is applied with the
-// standard SQL command directly. Otherwise the file is executed as a
-// command itself. It reports any errors
-func (prog *Prog) applyRelease() error {
-	sqlPrefix := dbtcommon.DbtDirReleaseSQL(
-		prog.dbp.BaseDirName, prog.releaseName)
+// order, after running any pre-release hook and followed by any
+// post-release hook. If the file is in the SQL directory then it is
+// applied with the standard SQL command directly. Otherwise the file is
+// executed as a command itself in the release directory with an
+// environment describing the release and the step. If the release is being
+// run in a transaction then consecutive SQL steps are applied together in
+// a single transaction. The steps in a parallel group are run
+// concurrently. Any steps already completed by a previous run which is
+// being resumed are skipped and the completion of each step is recorded.
+// Each step is stopped if it runs for longer than its timeout and no
+// further steps are run if the program is interrupted. It reports any
+// errors
+func (prog *Prog) applyRelease(ctx context.Context) error {
 	releaseDirPrefix := dbtcommon.DbtDirRelease(
 		prog.dbp.BaseDirName, prog.releaseName)
 
-	var cmd *exec.Cmd
+	out := prog.stdout()
 
 	if !prog.quiet {
-		fmt.Println("Release directory:", releaseDirPrefix)
-		fmt.Println("running:")
+		fmt.Fprintln(out, "Release directory:", releaseDirPrefix)
+		fmt.Fprintln(out, "running:")
 	}
 
-	for _, f := range prog.fileList {
-		if !prog.quiet {
-			relFile, err := filepath.Rel(releaseDirPrefix, f)
-			if err != nil {
-				relFile = f
+	defer prog.running.setSteps("")
+
+	if err := prog.runHook(ctx, dbtcommon.HookPreRelease); err != nil {
+		return err
+	}
+
+	for i := prog.skipSteps; i < len(prog.runMf.Steps); {
+		if txCount := prog.txStepCount(i); txCount > 0 {
+			txSteps := prog.runMf.Steps[i : i+txCount]
+
+			if !prog.quiet {
+				fmt.Fprintln(out, "\t BEGIN")
+
+				for _, s := range txSteps {
+					fmt.Fprintln(out, "\t\t", s.Name)
+				}
+
+				fmt.Fprintln(out, "\t COMMIT")
+			}
+
+			for _, s := range txSteps {
+				if err := s.CheckSum(); err != nil {
+					return err
+				}
+			}
+
+			if err := prog.runTxSteps(ctx, txSteps); err != nil {
+				return err
+			}
+
+			for j, s := range txSteps {
+				if err := prog.stepDone(i+j+1, s.Name); err != nil {
+					return err
+				}
 			}
 
-			fmt.Println("\t", relFile)
+			i += txCount
+
+			continue
 		}
 
-		if strings.HasPrefix(f, sqlPrefix) {
-			cmd = dbtcommon.SQLCommand(prog.dbp, f)
-		} else {
-			cmd = exec.Command(f) //nolint:gosec
+		if grpCount := prog.groupStepCount(i); grpCount > 0 {
+			grpSteps := prog.runMf.Steps[i : i+grpCount]
+
+			if !prog.quiet {
+				prog.printGroup(i, grpSteps)
+			}
+
+			for _, s := range grpSteps {
+				if err := s.CheckSum(); err != nil {
+					return err
+				}
+			}
+
+			if err := prog.runGroup(ctx, i, grpSteps); err != nil {
+				return err
+			}
+
+			i += grpCount
+
+			continue
 		}
 
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		s := prog.runMf.Steps[i]
 
-		err := cmd.Run()
-		if err != nil {
-			return fmt.Errorf("running %s: %s", f, err)
+		if !prog.quiet {
+			fmt.Fprintln(out, "\t", s.Name)
 		}
+
+		if err := s.CheckSum(); err != nil {
+			return err
+		}
+
+		if err := prog.runStep(ctx, i+1, s); err != nil {
+			return err
+		}
+
+		if err := prog.stepDone(i+1, s.Name); err != nil {
+			return err
+		}
+
+		i++
+	}
+
+	return prog.runHook(ctx, dbtcommon.HookPostRelease)
+}
+
+// runStep runs the single step, stopping it if it runs for longer than its
+// timeout or the program is interrupted
+func (prog *Prog) runStep(
+	ctx context.Context, stepNo int, s *dbtcommon.Step,
+) error {
+	desc := fmt.Sprintf("step %d of %d: %s",
+		stepNo, len(prog.runMf.Steps), s.Name)
+
+	removeScripts, err := prog.writeScripts(s)
+	if err != nil {
+		return err
+	}
+	defer removeScripts()
+
+	return prog.runStepCmd(ctx, desc, s, prog.stepCommand(stepNo, s))
+}
+
+// runStepCmd runs the command for the step, recording it in the transcript
+// with the given description. The command is stopped if it runs for longer
+// than the step timeout or the program is interrupted
+func (prog *Prog) runStepCmd(
+	ctx context.Context, desc string, s *dbtcommon.Step, cmd *exec.Cmd,
+) error {
+	errW := newPsqlErrWriter(prog.stderr(), prog.scripts[s])
+
+	cmd.Stdout = prog.stdout()
+	cmd.Stderr = errW
+
+	prog.running.setSteps(s.Name)
+
+	start := prog.transcript.stepStart(desc)
+
+	err := runCmd(ctx, cmd, prog.stepTimeoutFor(s))
+
+	errW.Flush()
+	prog.transcript.stepEnd(desc, start, err)
+
+	if err != nil {
+		return fmt.Errorf("running %s: %w", s.File, err)
 	}
 
 	return nil
@@ -225,21 +404,216 @@ type Prog struct {
 	quiet      bool
 	noWarn     bool
 	doNotApply bool
-
-	releaseName string
+	showDeps   bool
+	reapply    bool
+	resume     bool
+	plan       bool
+	rollback   bool
+
+	applyPending   bool
+	showOneRelease bool
+	updateSums     bool
+	archive        bool
+	archiveOnly    bool
+	includeArchive bool
+
+	inTransaction bool
+	stepTimeout   time.Duration
+	cleanEnv      bool
+	noMacros      bool
+	showSQL       bool
+
+	releaseName  string
+	ledgerSchema string
+	planFormat   string
+	showFormat   string
+	releaseOrder string
 
 	dbp *dbtcommon.DBParams
 
-	manifestMap map[string]location.L
-	fileList    []string
+	macroDirs  []string
+	macroCache *macros.Cache
+
+	acceptWarning []string
+
+	approve   bool
+	reviewers []string
+
+	noHooks bool
+	// hooks maps the names of the hook files to their parsed contents. A
+	// hook which is not to be run has no entry
+	hooks map[string]*dbtcommon.Manifest
+
+	mf         *dbtcommon.Manifest
+	rollbackMf *dbtcommon.Manifest
+	runMf      *dbtcommon.Manifest
+
+	// scripts holds the SQL, with its macros substituted, which is to be
+	// run for each SQL step which uses macros. If a step has no entry the
+	// file is run directly
+	scripts map[*dbtcommon.Step]*sqlScript
+
+	ledgerID  int64
+	skipSteps int
+	// doneSteps records the steps, beyond those to be skipped, which were
+	// completed by a previous run which is being resumed. These can only
+	// be steps in the parallel group at the restart point
+	doneSteps map[int]bool
+
+	maxParallel int
+
+	lockWait time.Duration
+
+	targets         []string
+	targetsFile     string
+	maxTargets      int
+	onTargetFailure string
+	// target is set if the release is being applied to one of several
+	// target databases
+	target bool
+
+	running *runState
+
+	// console, if set, receives the output which would otherwise be
+	// written to the standard output and standard error. It is used to
+	// collect the output when applying a release to several databases at
+	// once
+	console io.Writer
+
+	transcriptDirName string
+	noTranscript      bool
+	transcript        *transcript
+	// shown holds what was shown, and the response to any Warning, before
+	// the transcript was opened. It is written to the transcript when it
+	// is opened. It is used when applying a release to several databases
+	// as the ReadMe and Warning files are shown only once
+	shown []byte
 }
 
 // NewProg returns a new Prog value, correctly initialised
 func NewProg() *Prog {
 	return &Prog{
-		manifestMap: map[string]location.L{},
-		dbp:         dbtcommon.NewDBParams(),
+		dbp:          dbtcommon.NewDBParams(),
+		ledgerSchema: dfltLedgerSchema,
+		planFormat:   planFmtText,
+		showFormat:   showFmtList,
+		releaseOrder: relOrderDeps,
+		maxParallel:  dfltMaxParallel,
+		running:      &runState{},
+
+		maxTargets:      1,
+		onTargetFailure: targetFailStop,
+	}
+}
+
+// setRelease sets the name of the release to be processed and clears any
+// details of a previously processed release
+func (prog *Prog) setRelease(name string) {
+	prog.releaseName = name
+	prog.mf = nil
+	prog.rollbackMf = nil
+	prog.runMf = nil
+	prog.scripts = nil
+	prog.hooks = nil
+	prog.ledgerID = 0
+	prog.skipSteps = 0
+	prog.doneSteps = map[int]bool{}
+}
+
+// checkRelease checks the release directory, parses the manifest files and
+// checks the release directory against them. It then parses any hook files
+// and substitutes any macros in the SQL files. It returns any errors found
+func (prog *Prog) checkRelease() []error {
+	if err := prog.releaseDirIsOK(); err != nil {
+		return []error{err}
+	}
+
+	if errs := prog.parseManifest(); len(errs) > 0 {
+		return errs
+	}
+
+	if errs := prog.checkForUnusedFiles(); len(errs) > 0 {
+		return errs
+	}
+
+	if errs := prog.checkTransactionSteps(); len(errs) > 0 {
+		return errs
+	}
+
+	if errs := prog.parseHooks(); len(errs) > 0 {
+		return errs
 	}
+
+	return prog.expandSQLSteps()
+}
+
+// applyOneRelease checks that the release can be applied and that the
+// releases it requires have been applied. It then opens the transcript,
+// checks the release, shows any ReadMe and Warning files and then applies
+// it, recording the outcome in the release ledger. Finally it closes the
+// transcript and, if requested, archives the release. It returns any
+// errors found
+func (prog *Prog) applyOneRelease(ctx context.Context) []error {
+	if err := prog.checkCanApply(); err != nil {
+		return []error{err}
+	}
+
+	if !prog.rollback {
+		if err := prog.checkDependencies(); err != nil {
+			return []error{err}
+		}
+	}
+
+	if err := prog.openTranscript(); err != nil {
+		return []error{err}
+	}
+
+	errs := prog.applyCheckedRelease(ctx)
+	prog.closeTranscript(errs)
+
+	if len(errs) > 0 || !prog.archive {
+		return errs
+	}
+
+	// the transcript is closed before the release is archived as it is
+	// written, by default, in the release directory
+	if err := prog.archiveRelease(); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// applyCheckedRelease checks the release and its approval, if one is
+// required, shows any ReadMe and Warning files and then applies it,
+// recording the outcome in the release ledger. The release is checked
+// first so that the operator is not asked to confirm a release which
+// cannot be applied. The ReadMe and Warning files are not shown if this
+// is one of several target databases as they have already been shown. It
+// returns any errors found
+func (prog *Prog) applyCheckedRelease(ctx context.Context) []error {
+	if errs := prog.checkRelease(); len(errs) > 0 {
+		return errs
+	}
+
+	if err := prog.checkApproval(); err != nil {
+		return []error{err}
+	}
+
+	if !prog.target {
+		prog.showReadMe()
+		prog.showWarning()
+	}
+
+	if err := prog.findResumePoint(); err != nil {
+		return []error{err}
+	}
+
+	if err := prog.applyAndRecord(ctx); err != nil {
+		return []error{err}
+	}
+
+	return nil
 }
 
 func main() {
@@ -249,20 +623,68 @@ func main() {
 
 	prog.checkReleaseDir()
 
+	if prog.showOneRelease {
+		reportErrors(prog.showReleaseDetail())
+		exit(0)
+	}
+
 	if prog.doNotApply {
-		prog.showReleases("", "\t")
-		os.Exit(0)
+		if prog.showFormat == showFmtList {
+			prog.showReleases("", "\t")
+		} else {
+			reportErrors(prog.showReleaseReport())
+		}
+
+		exit(0)
 	}
 
-	prog.showReadMe()
-	prog.showWarning()
+	if prog.applyPending {
+		prog.applyPendingReleases(prog.handleSignals())
+		exit(0)
+	}
 
-	errors := prog.parseManifest()
-	reportErrors(errors...)
+	if prog.archiveOnly {
+		reportErrors(prog.archiveAppliedRelease())
+		exit(0)
+	}
 
-	errors = prog.checkForUnusedFiles()
-	reportErrors(errors...)
+	if prog.updateSums {
+		reportErrors(prog.parseManifest()...)
+		reportErrors(prog.checkForUnusedFiles()...)
+		reportErrors(prog.updateChecksums())
+		exit(0)
+	}
+
+	if prog.approve {
+		reportErrors(prog.checkRelease()...)
+		reportErrors(prog.approveRelease())
+		exit(0)
+	}
 
-	err := prog.applyRelease()
+	if prog.plan {
+		reportErrors(prog.checkRelease()...)
+		reportErrors(prog.showPlan())
+		exit(0)
+	}
+
+	if prog.showSQL {
+		reportErrors(prog.checkRelease()...)
+		reportErrors(prog.showExpandedSQL())
+		exit(0)
+	}
+
+	if prog.hasTargets() {
+		reportErrors(prog.applyToTargets(prog.handleSignals()))
+		exit(0)
+	}
+
+	ctx := prog.handleSignals()
+
+	lock, err := prog.lockDatabase(ctx)
 	reportErrors(err)
+
+	errs := prog.applyOneRelease(ctx)
+
+	lock.release()
+	reportErrors(errs...)
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// parseManifest parses the Manifest file and, if there is one, the
+// Rollback file. It then selects the manifest to be run.
+func (prog *Prog) parseManifest() []error {
+	var errors []error
+
+	prog.mf, prog.rollbackMf, errors = dbtcommon.ParseReleaseManifests(
+		prog.dbp.BaseDirName, prog.releaseName,
+		prog.rollback, prog.checkSums())
+
+	prog.runMf = prog.mf
+	if prog.rollback {
+		prog.runMf = prog.rollbackMf
+	}
+
+	return errors
+}
+
+// checkSums returns true if the checksums given in the manifest files
+// should be checked as the files are parsed. They are not checked if they
+// are being updated or if the full details of the release are being shown,
+// as the state of each step's checksum is then reported
+func (prog *Prog) checkSums() bool {
+	return !prog.updateSums && !prog.showOneRelease
+}
+
+// useTx returns true if the release should be run in a single transaction
+func (prog *Prog) useTx() bool {
+	return prog.inTransaction || prog.runMf.InTransaction
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestParseManifestSelection(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		rollback    bool
+		hasRollback bool
+		expRunFile  string
+		expRunSteps []string
+		expRbParsed bool
+	}{
+		{
+			ID:          testhelper.MkID("apply, no Rollback file"),
+			expRunFile:  dbtcommon.ReleaseManifestFileName,
+			expRunSteps: []string{"SQL.files/a.sql"},
+		},
+		{
+			ID:          testhelper.MkID("apply, with a Rollback file"),
+			hasRollback: true,
+			expRunFile:  dbtcommon.ReleaseManifestFileName,
+			expRunSteps: []string{"SQL.files/a.sql"},
+			expRbParsed: true,
+		},
+		{
+			ID:          testhelper.MkID("rollback, with a Rollback file"),
+			rollback:    true,
+			hasRollback: true,
+			expRunFile:  dbtcommon.ReleaseRollbackFileName,
+			expRunSteps: []string{"SQL.files/undo.sql"},
+			expRbParsed: true,
+		},
+		{
+			ID: testhelper.MkID("rollback, no Rollback file"),
+			ExpErr: testhelper.MkExpErr("does not contain a file called",
+				`"`+dbtcommon.ReleaseRollbackFileName+`"`),
+			rollback:    true,
+			expRunFile:  dbtcommon.ReleaseRollbackFileName,
+			expRbParsed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		files := map[string]string{
+			dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n",
+			"SQL.files/a.sql":                 "select 1;\n",
+		}
+		if tc.hasRollback {
+			files[dbtcommon.ReleaseRollbackFileName] = "SQL.files/undo.sql\n"
+			files["SQL.files/undo.sql"] = "select 2;\n"
+		}
+
+		prog := mkTestRelease(t, files)
+		prog.rollback = tc.rollback
+
+		errs := prog.parseManifest()
+		testhelper.CheckExpErr(t, errors.Join(errs...), tc)
+
+		testhelper.DiffBool(t, tc.IDStr(), "Rollback parsed",
+			prog.rollbackMf != nil, tc.expRbParsed)
+
+		if prog.runMf == nil {
+			t.Error(tc.IDStr(), ": no manifest has been chosen to run")
+			continue
+		}
+
+		testhelper.DiffString(t, tc.IDStr(), "manifest run",
+			filepath.Base(prog.runMf.FileName), tc.expRunFile)
+
+		var steps []string
+		for _, s := range prog.runMf.Steps {
+			steps = append(steps, s.Name)
+		}
+
+		testhelper.DiffStringSlice(t, tc.IDStr(), "steps run",
+			steps, tc.expRunSteps)
+	}
+}
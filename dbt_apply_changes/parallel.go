@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// dfltMaxParallel is the default for the greatest number of steps in a
+// parallel group which may run at the same time
+const dfltMaxParallel = 4
+
+// groupFailed is the cause of the steps in a parallel group being stopped
+// because another step in the group has failed
+type groupFailed struct {
+	stepName string
+}
+
+// Error returns a description of the cancellation
+func (e groupFailed) Error() string {
+	return "cancelled because " + e.stepName + " failed"
+}
+
+// groupStep holds the details of running a single step of a parallel
+// group. The output of the step is captured so that it can be shown, in
+// manifest order, once the whole group has finished.
+type groupStep struct {
+	stepNo int
+	step   *dbtcommon.Step
+
+	ran    bool
+	start  time.Time
+	end    time.Time
+	out    bytes.Buffer
+	errOut bytes.Buffer
+	err    error
+}
+
+// groupStepCount returns the number of consecutive steps, starting at the
+// given index, which are in the same parallel group as the step at the
+// index. It returns 0 if that step is not in a parallel group
+func (prog *Prog) groupStepCount(idx int) int {
+	g := prog.runMf.Steps[idx].Group
+	if g == nil {
+		return 0
+	}
+
+	count := 0
+
+	for _, s := range prog.runMf.Steps[idx:] {
+		if s.Group != g {
+			break
+		}
+
+		count++
+	}
+
+	return count
+}
+
+// maxParallelFor returns the greatest number of steps in the group which
+// may run at the same time. This is the maximum given in the manifest or,
+// if none was given, the default maximum
+func (prog *Prog) maxParallelFor(g *dbtcommon.ParallelGroup) int {
+	if g.Max > 0 {
+		return g.Max
+	}
+
+	return prog.maxParallel
+}
+
+// runGroupStep runs the step, capturing its output. The step is stopped if
+// it runs for longer than its timeout or the context is cancelled
+func (prog *Prog) runGroupStep(ctx context.Context, gs *groupStep) {
+	errW := newPsqlErrWriter(&gs.errOut, prog.scripts[gs.step])
+
+	gs.ran = true
+	gs.start = time.Now()
+
+	removeScripts, err := prog.writeScripts(gs.step)
+	if err != nil {
+		gs.err = err
+		gs.end = time.Now()
+
+		return
+	}
+	defer removeScripts()
+
+	cmd := prog.stepCommand(gs.stepNo, gs.step)
+	cmd.Stdout = &gs.out
+	cmd.Stderr = errW
+
+	gs.err = runCmd(ctx, cmd, prog.stepTimeoutFor(gs.step))
+	gs.end = time.Now()
+
+	errW.Flush()
+}
+
+// runGroup runs the steps of a parallel group, starting at the given step
+// index, with no more than the maximum for the group running at once. Any
+// steps already completed by a previous run which is being resumed are
+// skipped and the completion of each step is recorded as it finishes. If a
+// step fails then, depending on the group, the other steps are either
+// stopped and no more are started or they are all allowed to finish;
+// either way the group as a whole fails. Once every step has finished its
+// output is shown, in manifest order.
+func (prog *Prog) runGroup(
+	ctx context.Context, idx int, steps []*dbtcommon.Step,
+) error {
+	g := steps[0].Group
+
+	gCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		recErr []error
+	)
+
+	sem := make(chan struct{}, prog.maxParallelFor(g))
+	results := make([]*groupStep, 0, len(steps))
+
+	prog.running.setSteps(stepNames(steps))
+
+	for j, s := range steps {
+		stepNo := idx + j + 1
+		if prog.doneSteps[stepNo] {
+			continue
+		}
+
+		gs := &groupStep{stepNo: stepNo, step: s}
+		results = append(results, gs)
+
+		select {
+		case sem <- struct{}{}:
+		case <-gCtx.Done():
+		}
+
+		if err := context.Cause(gCtx); err != nil {
+			gs.err = err
+			continue
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			prog.runGroupStep(gCtx, gs)
+
+			if gs.err != nil {
+				if g.OnFailure == dbtcommon.OnFailureCancel {
+					cancel(groupFailed{stepName: s.Name})
+				}
+
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err := prog.stepDone(gs.stepNo, s.Name); err != nil {
+				recErr = append(recErr, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	errs := append(prog.showGroupResults(results), recErr...)
+	if len(errs) > 0 {
+		return fmt.Errorf("the parallel group (started at: %s) failed:\n%w",
+			g.Loc, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// showGroupResults shows the captured output of each step of the parallel
+// group, in manifest order, and records it in the transcript. It returns
+// an error for each step which failed or was not run
+func (prog *Prog) showGroupResults(results []*groupStep) []error {
+	var errs []error
+
+	for _, gs := range results {
+		if !gs.ran {
+			errs = append(errs,
+				fmt.Errorf("%s was not run: %w", gs.step.File, gs.err))
+
+			continue
+		}
+
+		desc := fmt.Sprintf("step %d of %d: %s",
+			gs.stepNo, len(prog.runMf.Steps), gs.step.Name)
+
+		prog.transcript.stepStarted(desc, gs.start)
+
+		if gs.out.Len() > 0 || gs.errOut.Len() > 0 {
+			fmt.Fprintln(prog.screen(), "\t--- output of", desc)
+		}
+
+		_, _ = gs.out.WriteTo(prog.stdout())
+		_, _ = gs.errOut.WriteTo(prog.stderr())
+
+		prog.transcript.stepEnded(desc, gs.start, gs.end, gs.err)
+
+		if gs.err != nil {
+			errs = append(errs,
+				fmt.Errorf("running %s: %w", gs.step.File, gs.err))
+		}
+	}
+
+	return errs
+}
+
+// printGroup prints the steps of the parallel group which are about to be
+// run, noting any which have already been completed
+func (prog *Prog) printGroup(idx int, steps []*dbtcommon.Step) {
+	g := steps[0].Group
+	out := prog.stdout()
+
+	fmt.Fprintf(out, "\t PARALLEL (at most %d at once, on failure: %s)\n",
+		prog.maxParallelFor(g), g.OnFailure)
+
+	for j, s := range steps {
+		if prog.doneSteps[idx+j+1] {
+			fmt.Fprintln(out, "\t\t", s.Name, "(already completed)")
+			continue
+		}
+
+		fmt.Fprintln(out, "\t\t", s.Name)
+	}
+
+	fmt.Fprintln(out, "\t END PARALLEL")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestRunGroup(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		onFailure   string
+		expSlowDone bool
+	}{
+		{
+			ID: testhelper.MkID("cancel on failure"),
+			ExpErr: testhelper.MkExpErr(
+				"the parallel group (started at: [Manifest]: ",
+				"Manifest:1) failed",
+				"fail.sh: exit status 3",
+				"slow.sh: cancelled because fail.sh failed"),
+			onFailure: dbtcommon.OnFailureCancel,
+		},
+		{
+			ID: testhelper.MkID("finish on failure"),
+			ExpErr: testhelper.MkExpErr(
+				"the parallel group (started at: [Manifest]: ",
+				"Manifest:1) failed",
+				"fail.sh: exit status 3"),
+			onFailure:   dbtcommon.OnFailureFinish,
+			expSlowDone: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := mkTestRelease(t, map[string]string{
+			dbtcommon.ReleaseManifestFileName: "@parallel on-failure=" +
+				tc.onFailure + "\n" +
+				"slow.sh\nfail.sh\n" +
+				"@end-parallel\n",
+			"slow.sh": "#!/bin/sh\nsleep 1\ntouch slow.done\n",
+			"fail.sh": "#!/bin/sh\nexit 3\n",
+		})
+		// nothing is recorded when rolling back so no database is needed
+		prog.rollback = true
+
+		relDir := dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, testRelName)
+		for _, f := range []string{"slow.sh", "fail.sh"} {
+			err := os.Chmod(filepath.Join(relDir, f), 0o755) //nolint:gosec
+			if err != nil {
+				t.Fatal("cannot make the step executable:", err)
+			}
+		}
+
+		prog.mf, prog.rollbackMf, _ = dbtcommon.ParseReleaseManifests(
+			prog.dbp.BaseDirName, testRelName, false, true)
+		prog.runMf = prog.mf
+
+		if n := prog.groupStepCount(0); n != 2 {
+			t.Fatal(tc.IDStr(), ": bad group step count:", n)
+		}
+
+		err := prog.runGroup(context.Background(), 0, prog.runMf.Steps)
+		testhelper.CheckExpErr(t, err, tc)
+
+		_, statErr := os.Stat(filepath.Join(relDir, "slow.done"))
+		testhelper.DiffBool(t, tc.IDStr(), "slow step finished",
+			statErr == nil, tc.expSlowDone)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// These are the available rules for ordering the pending releases
+const (
+	relOrderDeps    = "dependencies"
+	relOrderName    = "name"
+	relOrderNumeric = "numeric-prefix"
+)
+
+// orderByNumericPrefix sorts the releases by the numeric value of the
+// leading digits of their names and then by name. It is an error if any
+// release name does not start with a digit.
+func orderByNumericPrefix(releases []string) error {
+	var bad []string
+
+	for _, r := range releases {
+		if dbtcommon.ReleaseNumericPrefix(r) == "" {
+			bad = append(bad, r)
+		}
+	}
+
+	if len(bad) > 0 {
+		return fmt.Errorf(
+			"the releases cannot be ordered by %s,"+
+				" these releases do not start with a number: %s",
+			relOrderNumeric, strings.Join(bad, ", "))
+	}
+
+	// compare the prefixes without leading zeros, first by length and then
+	// lexically, so that arbitrarily long numbers can be compared
+	numVal := func(r string) string {
+		n := strings.TrimLeft(dbtcommon.ReleaseNumericPrefix(r), "0")
+		return n
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		ni, nj := numVal(releases[i]), numVal(releases[j])
+		if len(ni) != len(nj) {
+			return len(ni) < len(nj)
+		}
+
+		if ni != nj {
+			return ni < nj
+		}
+
+		return releases[i] < releases[j]
+	})
+
+	return nil
+}
+
+// orderByDependencies sorts the releases so that each release comes after
+// any release it requires. It is an error if the dependencies are not valid
+func (prog *Prog) orderByDependencies(releases []string) error {
+	g, errs := prog.releaseGraph()
+	errs = append(errs, g.check(releases)...)
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	g.order(releases)
+
+	return nil
+}
+
+// orderReleases sorts the releases according to the chosen ordering rule
+func (prog *Prog) orderReleases(releases []string) error {
+	switch prog.releaseOrder {
+	case relOrderDeps:
+		return prog.orderByDependencies(releases)
+	case relOrderNumeric:
+		return orderByNumericPrefix(releases)
+	default:
+		sort.Strings(releases)
+	}
+
+	return nil
+}
+
+// pendingReleases returns the releases which the release ledger does not
+// record as having been applied, in the order they should be applied
+func (prog *Prog) pendingReleases() ([]string, error) {
+	if err := prog.createLedger(); err != nil {
+		return nil, err
+	}
+
+	releases, err := prog.findReleases()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]string, 0, len(releases))
+
+	for _, r := range releases {
+		applied, err := prog.releaseIsApplied(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if !applied {
+			pending = append(pending, r)
+		}
+	}
+
+	if err := prog.orderReleases(pending); err != nil {
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+// applyPendingReleases finds the releases which have not yet been applied
+// and applies them, one after another, in order. It stops at the first
+// failure. The database is locked before the pending releases are found
+// so that they cannot be applied by anyone else in the meantime. If the
+// plan flag is set then the plan for each release is shown and nothing is
+// applied or locked. Similarly for the flag to show the expanded SQL
+func (prog *Prog) applyPendingReleases(ctx context.Context) {
+	if !prog.plan && !prog.showSQL {
+		lock, err := prog.lockDatabase(ctx)
+		reportErrors(err)
+
+		defer lock.release()
+	}
+
+	pending, err := prog.pendingReleases()
+	reportErrors(err)
+
+	if len(pending) == 0 {
+		fmt.Println("There are no pending releases")
+		return
+	}
+
+	if !prog.quiet || prog.plan || prog.showSQL {
+		fmt.Println("Pending releases, in the order they will be applied:")
+
+		for i, r := range pending {
+			fmt.Printf("\t%3d: %s\n", i+1, r)
+		}
+	}
+
+	if prog.plan || prog.showSQL {
+		for _, r := range pending {
+			prog.setRelease(r)
+
+			fmt.Println()
+			reportErrors(prog.checkRelease()...)
+
+			if prog.plan {
+				reportErrors(prog.showPlan())
+			} else {
+				reportErrors(prog.showExpandedSQL())
+			}
+		}
+
+		return
+	}
+
+	for i, r := range pending {
+		prog.setRelease(r)
+
+		if !prog.quiet {
+			fmt.Println()
+			fmt.Printf("Applying release %d of %d: %s\n", i+1, len(pending), r)
+		}
+
+		if errs := prog.applyOneRelease(ctx); len(errs) > 0 {
+			fmt.Printf("%s Release %q failed: %d of %d releases applied\n",
+				errorPrefix, r, i, len(pending))
+			reportErrors(errs...)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestOrderByNumericPrefix(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		releases []string
+		expOrder []string
+	}{
+		{
+			ID:       testhelper.MkID("in order"),
+			releases: []string{"1-a", "2-b", "10-c"},
+			expOrder: []string{"1-a", "2-b", "10-c"},
+		},
+		{
+			ID:       testhelper.MkID("numeric not lexical"),
+			releases: []string{"10-c", "2-b", "1-a"},
+			expOrder: []string{"1-a", "2-b", "10-c"},
+		},
+		{
+			ID:       testhelper.MkID("leading zeros and equal numbers"),
+			releases: []string{"002-z", "2-a", "01-x", "100000000000000000000"},
+			expOrder: []string{"01-x", "002-z", "2-a", "100000000000000000000"},
+		},
+		{
+			ID: testhelper.MkID("no prefix"),
+			ExpErr: testhelper.MkExpErr(
+				"these releases do not start with a number: a-1, b"),
+			releases: []string{"1-a", "a-1", "b"},
+		},
+	}
+
+	for _, tc := range testCases {
+		err := orderByNumericPrefix(tc.releases)
+		if testhelper.CheckExpErr(t, err, tc) && err == nil {
+			testhelper.DiffStringSlice(t, tc.IDStr(), "order",
+				tc.releases, tc.expOrder)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// These are the available formats for the plan output
+const (
+	planFmtText = "text"
+	planFmtJSON = "json"
+)
+
+// planStep holds the description of a single step in the plan
+type planStep struct {
+	StepNo  int      `json:"stepNo"`
+	File    string   `json:"file"`
+	Type    string   `json:"type"`
+	Command []string `json:"command"`
+	WorkDir string   `json:"workDir,omitempty"`
+	Size    int64    `json:"size"`
+	SHA256  string   `json:"sha256"`
+	InTx    bool     `json:"inTransaction"`
+	Timeout string   `json:"timeout,omitempty"`
+
+	Parallel *planGroup `json:"parallel,omitempty"`
+}
+
+// planGroup holds the description of the parallel group which a step is in
+type planGroup struct {
+	FirstStep int    `json:"firstStep"`
+	LastStep  int    `json:"lastStep"`
+	Max       int    `json:"max"`
+	OnFailure string `json:"onFailure"`
+}
+
+// plan holds the description of what applying the release would do
+type plan struct {
+	Release    string     `json:"release"`
+	ReleaseDir string     `json:"releaseDir"`
+	Database   string     `json:"database,omitempty"`
+	InTx       bool       `json:"transaction"`
+	Requires   []string   `json:"requires,omitempty"`
+	Steps      []planStep `json:"steps"`
+
+	PreRelease  []planStep `json:"preReleaseHook,omitempty"`
+	PostRelease []planStep `json:"postReleaseHook,omitempty"`
+}
+
+// makePlanStep constructs the plan for a single step. The step number
+// is 0 for a hook step
+func (prog *Prog) makePlanStep(stepNo int, s *dbtcommon.Step) (
+	planStep, error,
+) {
+	fStat, err := os.Stat(s.File)
+	if err != nil {
+		return planStep{}, err
+	}
+
+	sum, err := dbtcommon.FileSHA256(s.File)
+	if err != nil {
+		return planStep{}, err
+	}
+
+	cmd := prog.stepCommand(stepNo, s)
+
+	ps := planStep{
+		StepNo:  stepNo,
+		File:    s.Name,
+		Type:    s.StepType(),
+		Command: cmd.Args,
+		WorkDir: cmd.Dir,
+		Size:    fStat.Size(),
+		SHA256:  sum,
+	}
+
+	if t := prog.stepTimeoutFor(s); t > 0 {
+		ps.Timeout = t.String()
+	}
+
+	return ps, nil
+}
+
+// makeHookPlan constructs the plan for the steps of the named hook
+func (prog *Prog) makeHookPlan(hook string) ([]planStep, error) {
+	var steps []planStep
+
+	for _, s := range prog.hookSteps(hook) {
+		ps, err := prog.makePlanStep(0, s)
+		if err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, ps)
+	}
+
+	return steps, nil
+}
+
+// makePlan constructs the plan for the release from the manifest steps
+// and any hooks
+func (prog *Prog) makePlan() (plan, error) {
+	p := plan{
+		Release: prog.releaseName,
+		ReleaseDir: dbtcommon.DbtDirRelease(
+			prog.dbp.BaseDirName, prog.releaseName),
+		Database: prog.dbp.DbName,
+		InTx:     prog.useTx(),
+		Requires: prog.mf.Requires,
+		Steps:    make([]planStep, 0, len(prog.runMf.Steps)),
+	}
+
+	var err error
+
+	p.PreRelease, err = prog.makeHookPlan(dbtcommon.HookPreRelease)
+	if err != nil {
+		return p, err
+	}
+
+	p.PostRelease, err = prog.makeHookPlan(dbtcommon.HookPostRelease)
+	if err != nil {
+		return p, err
+	}
+
+	var pg *planGroup
+
+	for i, s := range prog.runMf.Steps {
+		if s.Group == nil {
+			pg = nil
+		} else if i == 0 || prog.runMf.Steps[i-1].Group != s.Group {
+			pg = &planGroup{
+				FirstStep: i + 1,
+				LastStep:  i + prog.groupStepCount(i),
+				Max:       prog.maxParallelFor(s.Group),
+				OnFailure: s.Group.OnFailure,
+			}
+		}
+
+		ps, err := prog.makePlanStep(i+1, s)
+		if err != nil {
+			return p, err
+		}
+
+		ps.Parallel = pg
+
+		if prog.useTx() && s.InTx() {
+			ps.InTx = true
+			ps.Command = dbtcommon.SQLCommand(prog.dbp, "-").Args
+		}
+
+		p.Steps = append(p.Steps, ps)
+	}
+
+	return p, nil
+}
+
+// quoteArg returns the argument quoted if it contains any characters which
+// would need quoting by the shell
+func quoteArg(arg string) string {
+	if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`*?[]{}()<>|&;#~") {
+		return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+
+	return arg
+}
+
+// printText prints the plan as plain text
+func (p plan) printText() {
+	fmt.Println("Release:          ", p.Release)
+	fmt.Println("Release directory:", p.ReleaseDir)
+
+	if p.Database != "" {
+		fmt.Println("Database:         ", p.Database)
+	}
+
+	if p.InTx {
+		fmt.Println("Transaction:       SQL steps are run in a transaction")
+	}
+
+	if len(p.Requires) > 0 {
+		fmt.Println("Requires:         ", strings.Join(p.Requires, ", "))
+	}
+
+	fmt.Println("Steps:            ", len(p.Steps))
+
+	for _, s := range p.PreRelease {
+		s.printText("Pre-release hook: " + s.File)
+	}
+
+	for _, s := range p.Steps {
+		s.printText(fmt.Sprintf("Step %d: %s", s.StepNo, s.File))
+	}
+
+	for _, s := range p.PostRelease {
+		s.printText("Post-release hook: " + s.File)
+	}
+}
+
+// printText prints the plan for the step as plain text, headed by the title
+func (s planStep) printText(title string) {
+	args := make([]string, 0, len(s.Command))
+	for _, a := range s.Command {
+		args = append(args, quoteArg(a))
+	}
+
+	fmt.Println()
+	fmt.Println(title)
+
+	typeDesc := s.Type
+	if s.Type == dbtcommon.StepTypeSQL {
+		typeDesc += " (applied via psql)"
+	}
+
+	if s.InTx {
+		typeDesc += " in the release transaction"
+	}
+
+	fmt.Println("\ttype:    ", typeDesc)
+	fmt.Println("\tcommand: ", strings.Join(args, " "))
+
+	if s.WorkDir != "" {
+		fmt.Println("\trun in:  ", s.WorkDir)
+	}
+
+	if g := s.Parallel; g != nil {
+		fmt.Printf("\tparallel: with steps %d-%d,"+
+			" at most %d at once, on failure: %s\n",
+			g.FirstStep, g.LastStep, g.Max, g.OnFailure)
+	}
+
+	fmt.Println("\tsize:    ", s.Size, "bytes")
+	fmt.Println("\tsha256:  ", s.SHA256)
+
+	if s.Timeout != "" {
+		fmt.Println("\ttimeout: ", s.Timeout)
+	}
+}
+
+// showPlan prints the plan in the chosen format
+func (prog *Prog) showPlan() error {
+	p, err := prog.makePlan()
+	if err != nil {
+		return err
+	}
+
+	if prog.planFormat == planFmtJSON {
+		return printJSON(p)
+	}
+
+	p.printText()
+
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcGroup does nothing as process groups are not supported
+func setProcGroup(_ *exec.Cmd) {}
+
+// signalProcGroup kills the process as process groups are not supported
+func signalProcGroup(p *os.Process, _ syscall.Signal) {
+	_ = p.Kill()
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// These are the descriptions of how the checksum of a step's file compares
+// with the checksum given in the manifest
+const (
+	sumStatusOK       = "matches"
+	sumStatusChanged  = "differs"
+	sumStatusNotGiven = "not given"
+)
+
+// stepDetail holds the description of a single step of a release
+type stepDetail struct {
+	Step           int      `json:"step"`
+	Name           string   `json:"name"`
+	File           string   `json:"file"`
+	Type           string   `json:"type"`
+	Lines          int      `json:"lines"`
+	SHA256         string   `json:"sha256,omitempty"`
+	ChecksumStatus string   `json:"checksumStatus"`
+	Attributes     []string `json:"attributes,omitempty"`
+	Problem        string   `json:"problem,omitempty"`
+}
+
+// manifestDetail holds the description of the steps in a manifest file
+type manifestDetail struct {
+	File          string       `json:"file"`
+	InTransaction bool         `json:"inTransaction"`
+	Steps         []stepDetail `json:"steps"`
+}
+
+// approvalDetail holds the description of the approval of a release
+type approvalDetail struct {
+	Required   bool     `json:"required"`
+	Approved   bool     `json:"approved"`
+	Reviewers  []string `json:"reviewers,omitempty"`
+	ApprovedAt string   `json:"approvedAt,omitempty"`
+	Problem    string   `json:"problem,omitempty"`
+}
+
+// releaseDetail holds the full description of a single release
+type releaseDetail struct {
+	Name            string          `json:"name"`
+	Dir             string          `json:"directory"`
+	ReadMe          string          `json:"readMe,omitempty"`
+	Warning         string          `json:"warning,omitempty"`
+	WarningSHA256   string          `json:"warningSHA256,omitempty"`
+	Requires        []string        `json:"requires,omitempty"`
+	Manifest        *manifestDetail `json:"manifest,omitempty"`
+	Rollback        *manifestDetail `json:"rollback,omitempty"`
+	PreReleaseHook  *manifestDetail `json:"preReleaseHook,omitempty"`
+	PostReleaseHook *manifestDetail `json:"postReleaseHook,omitempty"`
+	Approval        *approvalDetail `json:"approval,omitempty"`
+	Valid           bool            `json:"valid"`
+	Problems        []string        `json:"problems,omitempty"`
+	Database        string          `json:"database,omitempty"`
+	Status          string          `json:"status,omitempty"`
+	StatusTime      string          `json:"statusTime,omitempty"`
+}
+
+// countLines returns the number of lines in the text. A final line without
+// a newline is counted
+func countLines(text []byte) int {
+	n := bytes.Count(text, []byte("\n"))
+	if len(text) > 0 && text[len(text)-1] != '\n' {
+		n++
+	}
+
+	return n
+}
+
+// stepAttributes returns descriptions of the attributes of the step
+func stepAttributes(s *dbtcommon.Step) []string {
+	var attrs []string
+
+	if s.NoTransaction {
+		attrs = append(attrs, dbtcommon.AttrNoTransaction)
+	}
+
+	if s.TimeoutSet {
+		attrs = append(attrs, dbtcommon.AttrTimeout+"="+s.Timeout.String())
+	}
+
+	if s.Group != nil {
+		attrs = append(attrs, "parallel group at: "+s.Group.Loc.String())
+	}
+
+	return attrs
+}
+
+// makeStepDetail returns the description of the step
+func makeStepDetail(stepNo int, s *dbtcommon.Step) stepDetail {
+	sd := stepDetail{
+		Step:           stepNo,
+		Name:           s.Name,
+		File:           s.File,
+		Type:           s.StepType(),
+		ChecksumStatus: sumStatusNotGiven,
+		Attributes:     stepAttributes(s),
+	}
+
+	content, err := os.ReadFile(s.File) //nolint:gosec
+	if err != nil {
+		sd.Problem = err.Error()
+		return sd
+	}
+
+	sd.Lines = countLines(content)
+	sd.SHA256 = dbtcommon.BytesSHA256(content)
+
+	switch s.SHA256 {
+	case "":
+	case sd.SHA256:
+		sd.ChecksumStatus = sumStatusOK
+	default:
+		sd.ChecksumStatus = sumStatusChanged
+	}
+
+	return sd
+}
+
+// makeManifestDetail returns the description of the manifest or nil if the
+// manifest is nil
+func makeManifestDetail(mf *dbtcommon.Manifest) *manifestDetail {
+	if mf == nil {
+		return nil
+	}
+
+	md := &manifestDetail{
+		File:          mf.FileName,
+		InTransaction: mf.InTransaction,
+		Steps:         make([]stepDetail, 0, len(mf.Steps)),
+	}
+
+	for i, s := range mf.Steps {
+		md.Steps = append(md.Steps, makeStepDetail(i+1, s))
+	}
+
+	return md
+}
+
+// makeApprovalDetail returns the description of the approval of the
+// release. It returns nil if there is no approval and none is required
+func (prog *Prog) makeApprovalDetail() (*approvalDetail, error) {
+	ad := &approvalDetail{Required: prog.dbp.ApprovalRequired()}
+
+	a, err := dbtcommon.ReadApproval(prog.dbp.BaseDirName, prog.releaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	if a == nil {
+		if !ad.Required {
+			return nil, nil
+		}
+
+		return ad, nil
+	}
+
+	ad.Reviewers = a.Reviewers
+	ad.ApprovedAt = a.ApprovedAt.UTC().Format(time.RFC3339)
+
+	if prog.mf == nil {
+		ad.Problem = "the release cannot be checked against the approval"
+
+		return ad, nil
+	}
+
+	files, err := prog.releaseContents()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.Check(prog.releaseName, files); err != nil {
+		ad.Problem = err.Error()
+
+		return ad, nil
+	}
+
+	ad.Approved = true
+
+	return ad, nil
+}
+
+// readOptionalFile returns the contents of the file or an empty string if
+// it does not exist
+func readOptionalFile(name string) (string, error) {
+	content, err := os.ReadFile(name) //nolint:gosec
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	return string(content), err
+}
+
+// checkSumErrors returns an error for each step of the release, its
+// rollback and its hooks whose file does not match the checksum given for
+// it
+func (prog *Prog) checkSumErrors() []error {
+	var errs []error
+
+	for _, mf := range []*dbtcommon.Manifest{
+		prog.mf,
+		prog.rollbackMf,
+		prog.hooks[dbtcommon.HookPreRelease],
+		prog.hooks[dbtcommon.HookPostRelease],
+	} {
+		if mf == nil {
+			continue
+		}
+
+		for _, s := range mf.Steps {
+			if err := s.CheckSum(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+// getReleaseDetail checks the release and returns its full description.
+// The applied status is only set if the records are not nil
+func (prog *Prog) getReleaseDetail(
+	g relGraph, records map[string]ledgerRecord,
+) releaseDetail {
+	base := prog.dbp.BaseDirName
+	name := prog.releaseName
+
+	errs := prog.loadRelease(name, g)
+
+	rd := releaseDetail{
+		Name:     name,
+		Dir:      dbtcommon.DbtDirRelease(base, name),
+		Database: prog.dbp.DbName,
+	}
+
+	var err error
+
+	rd.ReadMe, err = readOptionalFile(
+		dbtcommon.DbtFileReleaseReadMe(base, name))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rd.Warning, err = readOptionalFile(
+		dbtcommon.DbtFileReleaseWarning(base, name))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rd.WarningSHA256, err = prog.warningSHA256()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if prog.mf != nil {
+		rd.Requires = prog.mf.Requires
+	}
+
+	errs = append(errs, prog.checkSumErrors()...)
+
+	rd.Manifest = makeManifestDetail(prog.mf)
+	rd.Rollback = makeManifestDetail(prog.rollbackMf)
+	rd.PreReleaseHook = makeManifestDetail(prog.hooks[dbtcommon.HookPreRelease])
+	rd.PostReleaseHook = makeManifestDetail(
+		prog.hooks[dbtcommon.HookPostRelease])
+
+	rd.Approval, err = prog.makeApprovalDetail()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rd.Valid = len(errs) == 0
+	rd.Problems = problems(errs)
+	rd.Status, rd.StatusTime = appliedStatus(name, records)
+
+	return rd
+}
+
+// printManifest prints the description of the steps in the manifest
+func printManifest(title string, md *manifestDetail) {
+	if md == nil {
+		return
+	}
+
+	fmt.Println()
+	fmt.Printf("%s: %s\n", title, md.File)
+
+	if md.InTransaction {
+		fmt.Println("\trun in a single transaction")
+	}
+
+	if len(md.Steps) == 0 {
+		fmt.Println("\tno steps")
+	}
+
+	for _, sd := range md.Steps {
+		fmt.Printf("\t%3d: %s\n", sd.Step, sd.Name)
+		fmt.Printf("\t     file:   %s\n", sd.File)
+
+		if sd.Problem != "" {
+			fmt.Printf("\t     %s %s\n", errorPrefix, sd.Problem)
+			continue
+		}
+
+		fmt.Printf("\t     type:   %s, lines: %d\n", sd.Type, sd.Lines)
+		fmt.Printf("\t     sha256: %s (%s in the manifest)\n",
+			sd.SHA256, sd.ChecksumStatus)
+
+		if len(sd.Attributes) > 0 {
+			fmt.Printf("\t     attributes: %s\n",
+				strings.Join(sd.Attributes, ", "))
+		}
+	}
+}
+
+// printApproval prints the description of the approval of the release
+func printApproval(ad *approvalDetail) {
+	if ad == nil {
+		return
+	}
+
+	fmt.Println()
+
+	required := ""
+	if ad.Required {
+		required = " (required for this database)"
+	}
+
+	switch {
+	case ad.Approved:
+		fmt.Printf("Approval: approved%s by %s at %s\n",
+			required, strings.Join(ad.Reviewers, ", "), ad.ApprovedAt)
+	case len(ad.Reviewers) > 0:
+		fmt.Printf("Approval: out of date%s, approved by %s at %s\n",
+			required, strings.Join(ad.Reviewers, ", "), ad.ApprovedAt)
+		fmt.Println("\t" + strings.ReplaceAll(ad.Problem, "\n", "\n\t"))
+	default:
+		fmt.Printf("Approval: not approved%s\n", required)
+	}
+}
+
+// printText prints the description of the release as text
+func (rd releaseDetail) printText() {
+	fmt.Println("Release:  ", rd.Name)
+	fmt.Println("Directory:", rd.Dir)
+
+	if len(rd.Requires) > 0 {
+		fmt.Println("Requires: ", strings.Join(rd.Requires, ", "))
+	}
+
+	if rd.Database != "" {
+		status := rd.Status
+		if rd.StatusTime != "" {
+			status += " at " + rd.StatusTime
+		}
+
+		fmt.Printf("Status:    %s (database: %s)\n", status, rd.Database)
+	}
+
+	printBlock(os.Stdout, rd.ReadMe, readMeTitle, readMeSep)
+
+	if printBlock(os.Stdout, rd.Warning, warningTitle, warningSep) {
+		printAcceptWarning(os.Stdout, rd.WarningSHA256)
+	}
+
+	printManifest(dbtcommon.ReleaseManifestFileName, rd.Manifest)
+	printManifest(dbtcommon.ReleaseRollbackFileName, rd.Rollback)
+	printManifest(hookDesc[dbtcommon.HookPreRelease]+" hook",
+		rd.PreReleaseHook)
+	printManifest(hookDesc[dbtcommon.HookPostRelease]+" hook",
+		rd.PostReleaseHook)
+	printApproval(rd.Approval)
+
+	fmt.Println()
+
+	if rd.Valid {
+		fmt.Println("No problems found")
+		return
+	}
+
+	fmt.Println("Problems:")
+
+	for _, p := range rd.Problems {
+		fmt.Println("\t" + strings.ReplaceAll(p, "\n", "\n\t"))
+	}
+}
+
+// showReleaseDetail prints the full description of the release in the
+// chosen format. The applied status is only shown if a database has been
+// given
+func (prog *Prog) showReleaseDetail() error {
+	g, records, err := prog.releaseState()
+	if err != nil {
+		return err
+	}
+
+	rd := prog.getReleaseDetail(g, records)
+
+	if prog.showFormat == showFmtJSON {
+		return printJSON(rd)
+	}
+
+	rd.printText()
+
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// These are the available formats for showing the releases
+const (
+	showFmtList  = "list"
+	showFmtTable = "table"
+	showFmtJSON  = "json"
+)
+
+// These are the values of the applied status of a release
+const (
+	relStatusApplied    = "applied"
+	relStatusRolledBack = "rolled-back"
+	relStatusNotApplied = "not-applied"
+)
+
+// releaseInfo holds the description of a release
+type releaseInfo struct {
+	Name          string   `json:"name"`
+	HasReadMe     bool     `json:"hasReadMe"`
+	HasWarning    bool     `json:"hasWarning"`
+	WarningSHA256 string   `json:"warningSHA256,omitempty"`
+	HasRollback   bool     `json:"hasRollback"`
+	Steps         int      `json:"steps"`
+	Valid         bool     `json:"valid"`
+	Problems      []string `json:"problems,omitempty"`
+	Requires      []string `json:"requires,omitempty"`
+	Status        string   `json:"status,omitempty"`
+	StatusTime    string   `json:"statusTime,omitempty"`
+}
+
+// archivedReleaseInfo holds the description of an archived release
+type archivedReleaseInfo struct {
+	Name       string `json:"name"`
+	DirName    string `json:"dirName"`
+	ArchivedAt string `json:"archivedAt"`
+}
+
+// releaseReport holds the descriptions of all the releases
+type releaseReport struct {
+	Database string                `json:"database,omitempty"`
+	Releases []releaseInfo         `json:"releases"`
+	Archived []archivedReleaseInfo `json:"archived,omitempty"`
+}
+
+// fileExists returns true if the file exists
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// appliedStatus returns the applied status of the named release, as
+// recorded in the ledger, and the time at which it was applied or rolled
+// back. No status is given if the records are nil
+func appliedStatus(
+	name string, records map[string]ledgerRecord,
+) (status, when string) {
+	if records == nil {
+		return "", ""
+	}
+
+	rec, ok := records[name]
+	if !ok {
+		return relStatusNotApplied, ""
+	}
+
+	if rec.outcome == outcomeRolledBack {
+		return relStatusRolledBack, rec.endTime
+	}
+
+	return relStatusApplied, rec.endTime
+}
+
+// releaseState returns the graph of the dependencies between the releases
+// and, if a database has been given, the ledger records of the releases
+// applied to it. The records are nil if no database has been given
+func (prog *Prog) releaseState() (relGraph, map[string]ledgerRecord, error) {
+	var records map[string]ledgerRecord
+
+	if prog.dbp.DbName != "" {
+		var err error
+
+		records, err = prog.releaseRecords()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// any problems reading the dependencies are also found when each
+	// release is checked and are reported against the release
+	g, _ := prog.releaseGraph()
+
+	return g, records, nil
+}
+
+// loadRelease sets the release to be the named release, checks it and
+// checks its dependencies. It returns any problems found
+func (prog *Prog) loadRelease(name string, g relGraph) []error {
+	prog.setRelease(name)
+
+	errs := prog.checkRelease()
+
+	return append(errs, g.check([]string{name})...)
+}
+
+// warningSHA256 returns the checksum of the Warning file of the release
+// or the empty string if it has no Warning file
+func (prog *Prog) warningSHA256() (string, error) {
+	warnFile := dbtcommon.DbtFileReleaseWarning(
+		prog.dbp.BaseDirName, prog.releaseName)
+	if !fileExists(warnFile) {
+		return "", nil
+	}
+
+	return dbtcommon.FileSHA256(warnFile)
+}
+
+// problems returns the text of the errors
+func problems(errs []error) []string {
+	var p []string
+
+	for _, err := range errs {
+		p = append(p, err.Error())
+	}
+
+	return p
+}
+
+// getReleaseInfo checks the named release and returns its description.
+// The applied status is only set if the records are not nil
+func (prog *Prog) getReleaseInfo(
+	name string, g relGraph, records map[string]ledgerRecord,
+) releaseInfo {
+	errs := prog.loadRelease(name, g)
+
+	base := prog.dbp.BaseDirName
+	ri := releaseInfo{
+		Name:        name,
+		HasReadMe:   fileExists(dbtcommon.DbtFileReleaseReadMe(base, name)),
+		HasWarning:  fileExists(dbtcommon.DbtFileReleaseWarning(base, name)),
+		HasRollback: fileExists(dbtcommon.DbtFileReleaseRollback(base, name)),
+	}
+
+	var err error
+
+	ri.WarningSHA256, err = prog.warningSHA256()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if prog.mf != nil {
+		ri.Steps = len(prog.mf.Steps)
+		ri.Requires = prog.mf.Requires
+	}
+
+	ri.Valid = len(errs) == 0
+	ri.Problems = problems(errs)
+	ri.Status, ri.StatusTime = appliedStatus(name, records)
+
+	return ri
+}
+
+// makeReleaseReport checks every release and returns the report describing
+// them. The applied status of each release is only given if a database has
+// been given
+func (prog *Prog) makeReleaseReport() (releaseReport, error) {
+	rpt := releaseReport{Database: prog.dbp.DbName}
+
+	releases, err := prog.findReleases()
+	if err != nil {
+		return rpt, err
+	}
+
+	g, records, err := prog.releaseState()
+	if err != nil {
+		return rpt, err
+	}
+
+	rpt.Releases = make([]releaseInfo, 0, len(releases))
+	for _, r := range releases {
+		rpt.Releases = append(rpt.Releases,
+			prog.getReleaseInfo(r, g, records))
+	}
+
+	prog.setRelease("")
+
+	if prog.includeArchive {
+		archived, err := prog.findArchivedReleases()
+		if err != nil {
+			return rpt, err
+		}
+
+		for _, ar := range archived {
+			rpt.Archived = append(rpt.Archived, archivedReleaseInfo{
+				Name:       ar.Name,
+				DirName:    ar.DirName,
+				ArchivedAt: ar.ArchivedAt.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	return rpt, nil
+}
+
+// yesNo returns "yes" or "no" according to the value of b
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
+
+// newTableWriter returns a writer which will align the tab-separated
+// columns of the text written to it
+func newTableWriter() *tabwriter.Writer {
+	const padding = 2
+
+	return tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', 0)
+}
+
+// printTable prints the report as a table
+func (rpt releaseReport) printTable() {
+	withStatus := rpt.Database != ""
+
+	tw := newTableWriter()
+
+	hdr := []string{"RELEASE", "STEPS", "VALID", "README", "WARNING",
+		"ROLLBACK"}
+	if withStatus {
+		hdr = append(hdr, "STATUS", "WHEN")
+	}
+
+	fmt.Fprintln(tw, strings.Join(hdr, "\t"))
+
+	for _, ri := range rpt.Releases {
+		cols := []string{
+			ri.Name,
+			strconv.Itoa(ri.Steps),
+			yesNo(ri.Valid),
+			yesNo(ri.HasReadMe),
+			yesNo(ri.HasWarning),
+			yesNo(ri.HasRollback),
+		}
+		if withStatus {
+			cols = append(cols, ri.Status, ri.StatusTime)
+		}
+
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	}
+
+	_ = tw.Flush()
+
+	for _, ri := range rpt.Releases {
+		if len(ri.Problems) == 0 {
+			continue
+		}
+
+		fmt.Println()
+		fmt.Printf("Problems with %s:\n", ri.Name)
+
+		for _, p := range ri.Problems {
+			fmt.Println("\t" + p)
+		}
+	}
+
+	if len(rpt.Archived) > 0 {
+		fmt.Println()
+
+		tw = newTableWriter()
+		fmt.Fprintln(tw, "ARCHIVED RELEASE\tARCHIVED AT\tDIRECTORY")
+
+		for _, ar := range rpt.Archived {
+			fmt.Fprintln(tw, ar.Name+"\t"+ar.ArchivedAt+"\t"+ar.DirName)
+		}
+
+		_ = tw.Flush()
+	}
+}
+
+// printJSON prints the value in JSON format
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "    ")
+
+	return enc.Encode(v)
+}
+
+// showReleaseReport prints the description of every release in the chosen
+// format
+func (prog *Prog) showReleaseReport() error {
+	rpt, err := prog.makeReleaseReport()
+	if err != nil {
+		return err
+	}
+
+	if prog.showFormat == showFmtJSON {
+		return printJSON(rpt)
+	}
+
+	rpt.printTable()
+
+	return nil
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+const testRelName = "testRel"
+
+// mkTestRelease creates a release directory in a temporary base directory
+// containing the given files and returns a Prog set up to use it
+func mkTestRelease(t *testing.T, files map[string]string) *Prog {
+	t.Helper()
+
+	prog := NewProg()
+	prog.dbp.BaseDirName = t.TempDir()
+	prog.releaseName = testRelName
+
+	relDir := dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, testRelName)
+
+	for name, content := range files {
+		fName := filepath.Join(relDir, name)
+
+		err := os.MkdirAll(filepath.Dir(fName), 0o755) //nolint:gosec
+		if err != nil {
+			t.Fatal("cannot make the release directory:", err)
+		}
+
+		err = os.WriteFile(fName, []byte(content), 0o644) //nolint:gosec
+		if err != nil {
+			t.Fatal("cannot make the release file:", err)
+		}
+	}
+
+	return prog
+}
+
+func TestCheckRelease(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		files map[string]string
+	}{
+		{
+			ID: testhelper.MkID("good release"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n" +
+					"SQL.files/sub/b.sql\nrun.sh\n",
+				"SQL.files/a.sql":               "select 1;\n",
+				"SQL.files/sub/b.sql":           "select 2;\n",
+				"run.sh":                        "#!/bin/sh\n",
+				dbtcommon.ReleaseReadMeFileName: "ReadMe\n",
+			},
+		},
+		{
+			ID: testhelper.MkID("good release, rollback manifest"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n",
+				dbtcommon.ReleaseRollbackFileName: "SQL.files/undo.sql\n",
+				"SQL.files/a.sql":                 "select 1;\n",
+				"SQL.files/undo.sql":              "select 2;\n",
+			},
+		},
+		{
+			ID: testhelper.MkID("unused files"),
+			ExpErr: testhelper.MkExpErr(
+				`contains "SQL.files/b.sql" which is not in the`,
+				`contains "SQL.files/sub/c.sql" which is not in the`,
+				`contains "other.sh" which is not in the`),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n",
+				"SQL.files/a.sql":                 "select 1;\n",
+				"SQL.files/b.sql":                 "select 2;\n",
+				"SQL.files/sub/c.sql":             "select 3;\n",
+				"other.sh":                        "#!/bin/sh\n",
+			},
+		},
+		{
+			ID: testhelper.MkID("manifest entries escaping the release"),
+			ExpErr: testhelper.MkExpErr(
+				`"../x.sql" is not within the release directory`,
+				`"/etc/passwd" is an absolute pathname`),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n" +
+					"../x.sql\n/etc/passwd\n",
+				"SQL.files/a.sql": "select 1;\n",
+			},
+		},
+		{
+			ID: testhelper.MkID("duplicate and missing entries"),
+			ExpErr: testhelper.MkExpErr(
+				"The file is already in the manifest",
+				`does not contain "SQL.files/b.sql"`),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n" +
+					"./SQL.files/a.sql\nSQL.files/b.sql\n",
+				"SQL.files/a.sql": "select 1;\n",
+			},
+		},
+		{
+			ID: testhelper.MkID("bad requires directives"),
+			ExpErr: testhelper.MkExpErr(
+				"A release cannot require itself",
+				`The release "other" is already required`,
+				`"../x" is not a valid release name`,
+				"The @requires directive may only be given in the Manifest"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "@requires other\n" +
+					"@requires " + testRelName + "\n" +
+					"@requires other\n" +
+					"@requires ../x\n" +
+					"SQL.files/a.sql\n",
+				dbtcommon.ReleaseRollbackFileName: "@requires other\n" +
+					"SQL.files/undo.sql\n",
+				"SQL.files/a.sql":    "select 1;\n",
+				"SQL.files/undo.sql": "select 2;\n",
+			},
+		},
+		{
+			ID: testhelper.MkID("good release, with fragments"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n" +
+					"@include grants\n",
+				dbtcommon.ReleaseRollbackFileName: "@include grants\n",
+				"SQL.files/a.sql":                 "select 1;\n",
+				"../Common/grants/Manifest": "SQL.files/grant.sql\n" +
+					"@include analyze\n",
+				"../Common/grants/SQL.files/grant.sql": "grant;\n",
+				"../Common/analyze/Manifest":           "analyze.sh\n",
+				"../Common/analyze/analyze.sh":         "#!/bin/sh\n",
+			},
+		},
+		{
+			ID: testhelper.MkID("bad fragments"),
+			ExpErr: testhelper.MkExpErr(
+				`There is no fragment called "nonesuch"`,
+				`The fragment "grants" has already been included`,
+				`"../x" is not a valid fragment name`,
+				`The fragment "bad" cannot be included`,
+				"The @transaction directive cannot be given in a fragment",
+				`"../../testRel/SQL.files/a.sql" is not within the`+
+					" fragment directory",
+				`the fragment directory (`,
+				`contains "unused.sql" which is not in its Manifest file`),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n" +
+					"@include nonesuch\n" +
+					"@include grants\n" +
+					"@include grants\n" +
+					"@include ../x\n" +
+					"@include bad\n",
+				"SQL.files/a.sql":                      "select 1;\n",
+				"../Common/grants/Manifest":            "SQL.files/grant.sql\n",
+				"../Common/grants/SQL.files/grant.sql": "grant;\n",
+				"../Common/grants/unused.sql":          "select 2;\n",
+				"../Common/bad/Manifest": "@transaction\n" +
+					"../../" + testRelName + "/SQL.files/a.sql\n" +
+					"@include grants\n",
+			},
+		},
+		{
+			ID: testhelper.MkID("good release, with parallel groups"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n" +
+					"@parallel\n" +
+					"SQL.files/b.sql\nSQL.files/c.sql\n" +
+					"@end-parallel\n" +
+					"@parallel max=2 on-failure=finish\n" +
+					"run.sh\n" +
+					"@end-parallel\n",
+				"SQL.files/a.sql": "select 1;\n",
+				"SQL.files/b.sql": "select 2;\n",
+				"SQL.files/c.sql": "select 3;\n",
+				"run.sh":          "#!/bin/sh\n",
+			},
+		},
+		{
+			ID: testhelper.MkID("bad parallel groups"),
+			ExpErr: testhelper.MkExpErr(
+				`The "max" attribute must be given a whole number`,
+				`The "on-failure" attribute must be given either`,
+				"Unknown @parallel attribute",
+				"Parallel groups cannot be nested",
+				"The @include directive cannot be given in a parallel group",
+				"The @end-parallel directive is not in a parallel group",
+				"is empty",
+				"The parallel group is not ended with @end-parallel",
+				`"SQL.files/c.sql" is in a parallel group`),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "@transaction\n" +
+					"@parallel max=0\n" +
+					"@parallel on-failure=ignore\n" +
+					"@parallel speed=fast\n" +
+					"@parallel\n" +
+					"SQL.files/a.sql no-transaction\n" +
+					"@parallel\n" +
+					"@include grants\n" +
+					"@end-parallel\n" +
+					"@end-parallel\n" +
+					"@parallel\n" +
+					"@end-parallel\n" +
+					"SQL.files/b.sql\n" +
+					"@parallel\n" +
+					"SQL.files/c.sql\n",
+				"SQL.files/a.sql":                      "select 1;\n",
+				"SQL.files/b.sql":                      "select 2;\n",
+				"SQL.files/c.sql":                      "select 3;\n",
+				"../Common/grants/Manifest":            "SQL.files/grant.sql\n",
+				"../Common/grants/SQL.files/grant.sql": "grant;\n",
+			},
+		},
+		{
+			ID: testhelper.MkID("checksums"),
+			ExpErr: testhelper.MkExpErr(
+				`The contents of "SQL.files/b.sql" have changed`,
+				`The "sha256" attribute must be given a SHA-256 checksum`,
+				`The "timeout" attribute must be given a non-negative`),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql sha256=" +
+					"4a45092ccf992ea92250053a80b931b7" +
+					"87924ba61648f420555511b84f10ab6c\n" +
+					"SQL.files/b.sql sha256=" +
+					"4a45092ccf992ea92250053a80b931b7" +
+					"87924ba61648f420555511b84f10ab6c\n" +
+					"SQL.files/c.sql sha256=xyz\n" +
+					"SQL.files/d.sql timeout=5m\n" +
+					"SQL.files/e.sql timeout=-5m\n",
+				"SQL.files/a.sql": "select 1;\n",
+				"SQL.files/b.sql": "select 2;\n",
+				"SQL.files/c.sql": "select 3;\n",
+				"SQL.files/d.sql": "select 4;\n",
+				"SQL.files/e.sql": "select 5;\n",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := mkTestRelease(t, tc.files)
+
+		errs := prog.parseManifest()
+		errs = append(errs, prog.checkForUnusedFiles()...)
+		errs = append(errs, prog.checkTransactionSteps()...)
+
+		testhelper.CheckExpErr(t, errors.Join(errs...), tc)
+	}
+}
+
+func TestGetReleaseInfo(t *testing.T) {
+	prog := mkTestRelease(t, map[string]string{
+		dbtcommon.ReleaseManifestFileName: "@requires other\n" +
+			"SQL.files/a.sql\nSQL.files/b.sql\n",
+		dbtcommon.ReleaseReadMeFileName:  "ReadMe\n",
+		dbtcommon.ReleaseWarningFileName: "Warning\n",
+		"SQL.files/a.sql":                "select 1;\n",
+	})
+	prog.noMacros = true
+
+	g := relGraph{testRelName: {name: testRelName, requires: []string{"other"}}}
+	records := map[string]ledgerRecord{
+		testRelName: {outcome: outcomeRolledBack, endTime: "2026-01-02"},
+	}
+
+	ri := prog.getReleaseInfo(testRelName, g, records)
+
+	testhelper.DiffInt(t, "releaseInfo", "steps", ri.Steps, 1)
+	testhelper.DiffBool(t, "releaseInfo", "valid", ri.Valid, false)
+	testhelper.DiffBool(t, "releaseInfo", "hasReadMe", ri.HasReadMe, true)
+	testhelper.DiffBool(t, "releaseInfo", "hasWarning", ri.HasWarning, true)
+	testhelper.DiffString(t, "releaseInfo", "warning checksum",
+		ri.WarningSHA256,
+		"2f2ef88bb0cbd69e4c34c9109cc0f73e7ef3c95798d8b3a09e9dd0819166a06c")
+	testhelper.DiffStringSlice(t, "releaseInfo", "requires",
+		ri.Requires, []string{"other"})
+	testhelper.DiffString(t, "releaseInfo", "status",
+		ri.Status, relStatusRolledBack)
+	testhelper.DiffString(t, "releaseInfo", "status time",
+		ri.StatusTime, "2026-01-02")
+	testhelper.DiffInt(t, "releaseInfo", "problem count", len(ri.Problems), 2)
+}
+
+func TestGetReleaseDetail(t *testing.T) {
+	prog := mkTestRelease(t, map[string]string{
+		dbtcommon.ReleaseManifestFileName: "@requires other\n" +
+			"SQL.files/a.sql sha256=" +
+			"2f2ef88bb0cbd69e4c34c9109cc0f73e7ef3c95798d8b3a09e9dd0819166a06c" +
+			"\nrun.sh timeout=5m\n",
+		dbtcommon.ReleaseRollbackFileName: "SQL.files/undo.sql\n",
+		dbtcommon.ReleaseReadMeFileName:   "ReadMe\n",
+		"SQL.files/a.sql":                 "select 1;\nselect 2;",
+		"SQL.files/undo.sql":              "select 3;\n",
+		"SQL.files/extra.sql":             "select 4;\n",
+		"run.sh":                          "#!/bin/sh\n",
+	})
+	prog.noMacros = true
+	prog.showOneRelease = true
+
+	g := relGraph{testRelName: {name: testRelName, requires: []string{"other"}}}
+
+	rd := prog.getReleaseDetail(g, nil)
+
+	testhelper.DiffString(t, "releaseDetail", "ReadMe", rd.ReadMe, "ReadMe\n")
+	testhelper.DiffString(t, "releaseDetail", "Warning", rd.Warning, "")
+	testhelper.DiffStringSlice(t, "releaseDetail", "requires",
+		rd.Requires, []string{"other"})
+	testhelper.DiffString(t, "releaseDetail", "status", rd.Status, "")
+	testhelper.DiffBool(t, "releaseDetail", "valid", rd.Valid, false)
+	testhelper.DiffInt(t, "releaseDetail", "problem count",
+		len(rd.Problems), 3)
+	testhelper.DiffBool(t, "releaseDetail", "changed file is a problem",
+		slices.ContainsFunc(rd.Problems, func(p string) bool {
+			return strings.Contains(p,
+				`The contents of "SQL.files/a.sql" have changed`)
+		}), true)
+
+	if rd.Manifest == nil || rd.Rollback == nil {
+		t.Fatal("the manifest and rollback details should be given")
+	}
+
+	testhelper.DiffInt(t, "releaseDetail", "manifest steps",
+		len(rd.Manifest.Steps), 2)
+	testhelper.DiffInt(t, "releaseDetail", "rollback steps",
+		len(rd.Rollback.Steps), 1)
+
+	sql, exe := rd.Manifest.Steps[0], rd.Manifest.Steps[1]
+
+	testhelper.DiffInt(t, "SQL step", "step number", sql.Step, 1)
+	testhelper.DiffInt(t, "executable step", "step number", exe.Step, 2)
+	testhelper.DiffString(t, "executable step", "name", exe.Name, "run.sh")
+
+	testhelper.DiffString(t, "SQL step", "type", sql.Type,
+		dbtcommon.StepTypeSQL)
+	testhelper.DiffInt(t, "SQL step", "lines", sql.Lines, 2)
+	testhelper.DiffString(t, "SQL step", "checksum status",
+		sql.ChecksumStatus, sumStatusChanged)
+	testhelper.DiffString(t, "executable step", "type", exe.Type,
+		dbtcommon.StepTypeExec)
+	testhelper.DiffInt(t, "executable step", "lines", exe.Lines, 1)
+	testhelper.DiffString(t, "executable step", "checksum status",
+		exe.ChecksumStatus, sumStatusNotGiven)
+	testhelper.DiffStringSlice(t, "executable step", "attributes",
+		exe.Attributes, []string{"timeout=5m0s"})
+}
+
+func TestAppliedStatus(t *testing.T) {
+	records := map[string]ledgerRecord{
+		"r1": {outcome: outcomeSuccess, endTime: "2026-01-01"},
+		"r2": {outcome: outcomeRolledBack, endTime: "2026-01-02"},
+	}
+
+	testCases := []struct {
+		testhelper.ID
+		name      string
+		records   map[string]ledgerRecord
+		expStatus string
+		expWhen   string
+	}{
+		{
+			ID:   testhelper.MkID("no database"),
+			name: "r1",
+		},
+		{
+			ID:        testhelper.MkID("applied"),
+			name:      "r1",
+			records:   records,
+			expStatus: relStatusApplied,
+			expWhen:   "2026-01-01",
+		},
+		{
+			ID:        testhelper.MkID("rolled back"),
+			name:      "r2",
+			records:   records,
+			expStatus: relStatusRolledBack,
+			expWhen:   "2026-01-02",
+		},
+		{
+			ID:        testhelper.MkID("not applied"),
+			name:      "r3",
+			records:   records,
+			expStatus: relStatusNotApplied,
+		},
+	}
+
+	for _, tc := range testCases {
+		status, when := appliedStatus(tc.name, tc.records)
+		testhelper.DiffString(t, tc.IDStr(), "status", status, tc.expStatus)
+		testhelper.DiffString(t, tc.IDStr(), "when", when, tc.expWhen)
+	}
+}
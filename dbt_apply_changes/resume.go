@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// completedStep records a manifest step which has been completed. The step
+// number counts from 1 and the file is relative to the release directory
+type completedStep struct {
+	stepNo int
+	file   string
+}
+
+// findResumePoint sets the number of steps to skip when resuming a failed
+// release. The completed steps must match the start of the manifest
+// exactly, otherwise the manifest has changed since the failed run and an
+// error is returned. The exception is that the steps in a parallel group
+// may have completed in any order, so some of the steps of the group at
+// the restart point may have completed already; these are recorded and
+// will not be run again. The steps to be skipped are listed.
+func (prog *Prog) findResumePoint() error {
+	if !prog.resume {
+		return nil
+	}
+
+	done, err := prog.completedSteps()
+	if err != nil {
+		return err
+	}
+
+	steps := prog.runMf.Steps
+	isDone := make(map[int]bool, len(done))
+
+	for _, cs := range done {
+		if cs.stepNo < 1 || cs.stepNo > len(steps) {
+			return fmt.Errorf(
+				"cannot resume %q: step %d (%s) is recorded as completed"+
+					" but the %s only has %d steps",
+				prog.releaseName, cs.stepNo, cs.file,
+				dbtcommon.ReleaseManifestFileName, len(steps))
+		}
+
+		manifestFile := steps[cs.stepNo-1].Name
+
+		if cs.file != manifestFile {
+			return fmt.Errorf(
+				"cannot resume %q: the completed step %d (%s) does not"+
+					" match step %d (%s) of the %s."+
+					" It may have changed since the failed run",
+				prog.releaseName, cs.stepNo, cs.file,
+				cs.stepNo, manifestFile, dbtcommon.ReleaseManifestFileName)
+		}
+
+		isDone[cs.stepNo] = true
+	}
+
+	skip := 0
+	for skip < len(steps) && isDone[skip+1] {
+		skip++
+	}
+
+	for _, cs := range done {
+		if cs.stepNo <= skip {
+			continue
+		}
+
+		if g := steps[skip].Group; g == nil || steps[cs.stepNo-1].Group != g {
+			return fmt.Errorf(
+				"cannot resume %q: step %d (%s) is recorded as completed"+
+					" but step %d (%s) is not and they are not in the same"+
+					" parallel group. The %s may have changed since the"+
+					" failed run",
+				prog.releaseName, cs.stepNo, cs.file,
+				skip+1, steps[skip].Name, dbtcommon.ReleaseManifestFileName)
+		}
+
+		prog.doneSteps[cs.stepNo] = true
+	}
+
+	prog.skipSteps = skip
+
+	out := prog.screen()
+
+	if len(done) == 0 {
+		fmt.Fprintln(out,
+			"No steps have been completed - all steps will be run")
+		return nil
+	}
+
+	fmt.Fprintln(out, "Resuming - these completed steps will be skipped:")
+
+	for _, cs := range done {
+		fmt.Fprintf(out, "\t%3d: %s\n", cs.stepNo, cs.file)
+	}
+
+	if len(prog.doneSteps) > 0 {
+		fmt.Fprintf(out,
+			"Restarting in the parallel group started at: %s\n",
+			steps[prog.skipSteps].Group.Loc)
+	}
+
+	if prog.skipSteps == len(prog.runMf.Steps) {
+		fmt.Fprintln(out, "All the steps have been completed")
+	} else {
+		fmt.Fprintf(out, "Restarting at step %d: %s\n",
+			prog.skipSteps+1, prog.runMf.Steps[prog.skipSteps].Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestFindResumePoint(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		noResume     bool
+		done         []string
+		expSkip      int
+		expDoneSteps []int
+	}{
+		{
+			ID:       testhelper.MkID("not resuming"),
+			noResume: true,
+			done:     []string{"1\tSQL.files/a.sql"},
+		},
+		{
+			ID: testhelper.MkID("nothing done"),
+		},
+		{
+			ID:      testhelper.MkID("first step done"),
+			done:    []string{"1\tSQL.files/a.sql"},
+			expSkip: 1,
+		},
+		{
+			ID: testhelper.MkID("all done"),
+			done: []string{
+				"1\tSQL.files/a.sql", "2\tb.sh", "3\tc.sh", "4\td.sh",
+			},
+			expSkip: 4,
+		},
+		{
+			ID:           testhelper.MkID("parallel group partly done"),
+			done:         []string{"1\tSQL.files/a.sql", "3\tc.sh"},
+			expSkip:      1,
+			expDoneSteps: []int{3},
+		},
+		{
+			ID: testhelper.MkID("changed step"),
+			ExpErr: testhelper.MkExpErr(
+				`cannot resume "testRel": the completed step 1`,
+				"(SQL.files/x.sql) does not match step 1 (SQL.files/a.sql)"),
+			done: []string{"1\tSQL.files/x.sql"},
+		},
+		{
+			ID: testhelper.MkID("step beyond the manifest"),
+			ExpErr: testhelper.MkExpErr(
+				"step 9 (z.sh) is recorded as completed",
+				"only has 4 steps"),
+			done: []string{"1\tSQL.files/a.sql", "9\tz.sh"},
+		},
+		{
+			ID: testhelper.MkID("gap outside a parallel group"),
+			ExpErr: testhelper.MkExpErr(
+				"step 4 (d.sh) is recorded as completed",
+				"but step 2 (b.sh) is not",
+				"not in the same parallel group"),
+			done: []string{"1\tSQL.files/a.sql", "4\td.sh"},
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := mkTestRelease(t, map[string]string{
+			dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n" +
+				"@parallel\nb.sh\nc.sh\n@end-parallel\n" +
+				"d.sh\n",
+			"SQL.files/a.sql": "select 1;\n",
+			"b.sh":            "#!/bin/sh\n",
+			"c.sh":            "#!/bin/sh\n",
+			"d.sh":            "#!/bin/sh\n",
+		})
+		prog.setRelease(testRelName)
+		prog.resume = !tc.noResume
+		prog.console = io.Discard
+
+		if errs := prog.parseManifest(); len(errs) > 0 {
+			t.Fatal(tc.IDStr(), ": cannot parse the manifest:", errs)
+		}
+
+		// the fake psql reports the completed steps
+		rows := strings.Join(tc.done, "\n")
+		if rows != "" {
+			rows += "\n"
+		}
+
+		prog.dbp.PsqlPath = filepath.Join(t.TempDir(), "psql")
+
+		err := os.WriteFile(prog.dbp.PsqlPath, //nolint:gosec
+			[]byte("#!/bin/sh\nprintf '"+rows+"'\n"), 0o755)
+		if err != nil {
+			t.Fatal("cannot write the fake psql:", err)
+		}
+
+		err = prog.findResumePoint()
+		if testhelper.CheckExpErr(t, err, tc) && err == nil {
+			testhelper.DiffInt(t, tc.IDStr(), "skipped steps",
+				prog.skipSteps, tc.expSkip)
+
+			testhelper.DiffSlice(t, tc.IDStr(), "done steps",
+				slices.Sorted(maps.Keys(prog.doneSteps)), tc.expDoneSteps)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// These are the exit statuses used when a step does not complete
+const (
+	exitStatusFailure = 1
+	exitStatusTimeout = 124
+	exitStatusSignal  = 128 // the signal number is added to this
+)
+
+// killDelay is how long a step is given to finish after it has been asked
+// to stop before it is killed
+const killDelay = 10 * time.Second
+
+// stepTimeout is the cause of a step being stopped because it has run for
+// too long
+type stepTimeout struct {
+	timeout time.Duration
+}
+
+// Error returns a description of the timeout
+func (e stepTimeout) Error() string {
+	return "timed out after " + e.timeout.String()
+}
+
+// interrupted is the cause of a step being stopped because the program
+// has received a signal
+type interrupted struct {
+	sig os.Signal
+}
+
+// Error returns a description of the interruption
+func (e interrupted) Error() string {
+	return "interrupted by signal: " + e.sig.String()
+}
+
+// exitStatus returns the exit status signal number for the interruption
+func (e interrupted) exitStatus() int {
+	if sig, ok := e.sig.(syscall.Signal); ok {
+		return exitStatusSignal + int(sig)
+	}
+
+	return exitStatusFailure
+}
+
+// errorExitStatus returns the exit status to use for the errors. An
+// interruption takes precedence over a timeout which takes precedence
+// over any other failure
+func errorExitStatus(errs ...error) int {
+	status := exitStatusFailure
+
+	for _, err := range errs {
+		var (
+			intr interrupted
+			tout stepTimeout
+		)
+
+		if errors.As(err, &intr) {
+			return intr.exitStatus()
+		}
+
+		if errors.As(err, &tout) {
+			status = exitStatusTimeout
+		}
+	}
+
+	return status
+}
+
+// runState records the steps currently being run so that an interruption
+// can be reported against them. It is shared by all the targets when a
+// release is being applied to several databases
+type runState struct {
+	mu       sync.Mutex
+	applying int
+	steps    string
+}
+
+// setApplying records that a release has started or finished being
+// applied. Releases may be applied to several databases at once
+func (rs *runState) setApplying(applying bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if applying {
+		rs.applying++
+	} else {
+		rs.applying--
+	}
+}
+
+// setSteps records the names of the steps being run
+func (rs *runState) setSteps(steps string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.steps = steps
+}
+
+// get returns whether or not a release is being applied and the names of
+// the steps being run
+func (rs *runState) get() (bool, string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return rs.applying > 0, rs.steps
+}
+
+// handleSignals returns a context which is cancelled when the program
+// receives an interrupt or termination signal. If a release is being
+// applied the running step is stopped and the release ends with the
+// interruption recorded. Otherwise, or if a second signal is received, the
+// program exits immediately.
+func (prog *Prog) handleSignals() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigs
+		cause := interrupted{sig: sig}
+
+		applying, steps := prog.running.get()
+		if !applying {
+			fmt.Println()
+			fmt.Println(errorPrefix, cause)
+			exit(cause.exitStatus())
+		}
+
+		if steps != "" {
+			fmt.Printf("\n%s %s: stopping: %s\n", errorPrefix, cause, steps)
+		} else {
+			fmt.Printf("\n%s %s: no further steps will be run\n",
+				errorPrefix, cause)
+		}
+
+		cancel(cause)
+
+		sig = <-sigs
+		cause = interrupted{sig: sig}
+		fmt.Println(errorPrefix, cause, "- exiting immediately")
+		exit(cause.exitStatus())
+	}()
+
+	return ctx
+}
+
+// runCmd runs the command, stopping it if the context is cancelled or the
+// timeout, if greater than zero, expires. The command is run in its own
+// process group and the whole group is stopped, first with a termination
+// signal and then, if it has not finished after a delay, by killing it. If
+// the command fails after the context is cancelled the cause of the
+// cancellation is returned; a command which succeeds regardless is not
+// reported as failing.
+func runCmd(ctx context.Context, cmd *exec.Cmd, timeout time.Duration,
+) error {
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout,
+			stepTimeout{timeout: timeout})
+		defer cancel()
+	}
+
+	setProcGroup(cmd)
+	cmd.WaitDelay = killDelay
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			signalProcGroup(cmd.Process, syscall.SIGTERM)
+
+			select {
+			case <-done:
+			case <-time.After(killDelay):
+				signalProcGroup(cmd.Process, syscall.SIGKILL)
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+
+	close(done)
+
+	if err != nil {
+		if cause := context.Cause(ctx); cause != nil {
+			return cause
+		}
+	}
+
+	return err
+}
+
+// stepTimeoutFor returns the timeout for the step. This is the timeout
+// given in the manifest or, if none was given, the default step timeout. A
+// value of zero means that there is no timeout
+func (prog *Prog) stepTimeoutFor(s *dbtcommon.Step) time.Duration {
+	if s.TimeoutSet {
+		return s.Timeout
+	}
+
+	return prog.stepTimeout
+}
+
+// groupTimeout returns the timeout for a group of steps which are run
+// together. This is the sum of the timeouts of the steps or zero (no
+// timeout) if any of the steps has no timeout
+func (prog *Prog) groupTimeout(steps []*dbtcommon.Step) time.Duration {
+	var total time.Duration
+
+	for _, s := range steps {
+		t := prog.stepTimeoutFor(s)
+		if t == 0 {
+			return 0
+		}
+
+		total += t
+	}
+
+	return total
+}
+
+// stepNames returns the names of the steps as a comma-separated list
+func stepNames(steps []*dbtcommon.Step) string {
+	names := make([]string, 0, len(steps))
+	for _, s := range steps {
+		names = append(names, s.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestErrorExitStatus(t *testing.T) {
+	tout := fmt.Errorf("running x: %w", stepTimeout{timeout: time.Second})
+	intr := fmt.Errorf("running y: %w", interrupted{sig: syscall.SIGINT})
+	fail := errors.New("failed")
+
+	testCases := []struct {
+		testhelper.ID
+		errs      []error
+		expStatus int
+	}{
+		{
+			ID:        testhelper.MkID("failure"),
+			errs:      []error{fail},
+			expStatus: exitStatusFailure,
+		},
+		{
+			ID:        testhelper.MkID("timeout"),
+			errs:      []error{fail, errors.Join(tout, fail)},
+			expStatus: exitStatusTimeout,
+		},
+		{
+			ID:        testhelper.MkID("interrupted"),
+			errs:      []error{tout, intr},
+			expStatus: exitStatusSignal + int(syscall.SIGINT),
+		},
+	}
+
+	for _, tc := range testCases {
+		testhelper.DiffInt(t, tc.IDStr(), "exit status",
+			errorExitStatus(tc.errs...), tc.expStatus)
+	}
+}
+
+func TestRunCmd(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		script     string
+		timeout    time.Duration
+		expErr     bool
+		expTimeout bool
+	}{
+		{
+			ID:     testhelper.MkID("success"),
+			script: "exit 0",
+		},
+		{
+			ID:     testhelper.MkID("failure"),
+			script: "exit 1",
+			expErr: true,
+		},
+		{
+			ID:         testhelper.MkID("timed out"),
+			script:     "sleep 10",
+			timeout:    100 * time.Millisecond,
+			expErr:     true,
+			expTimeout: true,
+		},
+		{
+			ID:      testhelper.MkID("succeeds when stopped"),
+			script:  "trap 'exit 0' TERM; sleep 10 & wait",
+			timeout: 100 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := runCmd(context.Background(),
+			exec.Command("sh", "-c", tc.script), tc.timeout)
+
+		testhelper.DiffBool(t, tc.IDStr(), "error", err != nil, tc.expErr)
+
+		var st stepTimeout
+		testhelper.DiffBool(t, tc.IDStr(), "timed out",
+			errors.As(err, &st), tc.expTimeout)
+	}
+}
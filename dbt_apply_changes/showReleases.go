@@ -4,6 +4,8 @@ import (
 	"fmt"
 )
 
+const archiveShowTimeFmt = "2006-01-02 15:04:05"
+
 // showReleases this shows all the releases in the releaseScripts directory
 func (prog *Prog) showReleases(indent, relIndent string) {
 	releases, err := prog.findReleases()
@@ -20,5 +22,57 @@ func (prog *Prog) showReleases(indent, relIndent string) {
 		for _, r := range releases {
 			fmt.Println(relIndent, r)
 		}
+
+		if prog.showDeps {
+			prog.showReleaseGraph(releases, indent, relIndent)
+		}
+	}
+
+	if prog.includeArchive {
+		prog.showArchivedReleases(indent, relIndent)
+	}
+}
+
+// showArchivedReleases shows all the releases in the Archive directory
+// together with the date they were archived
+func (prog *Prog) showArchivedReleases(indent, relIndent string) {
+	archived, err := prog.findArchivedReleases()
+	if err != nil {
+		fmt.Println(indent+"Error:", err)
+		return
+	}
+
+	if len(archived) == 0 {
+		fmt.Println(indent + "There are no archived releases")
+		return
+	}
+
+	fmt.Println(indent + "Archived releases:")
+
+	for _, ar := range archived {
+		fmt.Println(relIndent, ar.Name,
+			"(archived: "+ar.ArchivedAt.Format(archiveShowTimeFmt)+
+				" as "+ar.DirName+")")
+	}
+}
+
+// showReleaseGraph shows the releases which each release requires together
+// with any problems with the dependencies
+func (prog *Prog) showReleaseGraph(
+	releases []string, indent, relIndent string,
+) {
+	g, errs := prog.releaseGraph()
+	errs = append(errs, g.check(releases)...)
+
+	fmt.Println()
+	fmt.Println(indent + "Release dependencies:")
+
+	for _, r := range releases {
+		fmt.Println(relIndent, r)
+		g.showDependencies(r, relIndent+"     ", []string{r})
+	}
+
+	for _, err := range errs {
+		fmt.Println(indent+errorPrefix, err)
 	}
 }
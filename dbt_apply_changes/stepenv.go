@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/param.mod/v7/param"
+)
+
+// These are the names of the environment variables which are set for each
+// executable step
+const (
+	envRelease    = dbtcommon.DbtEnvPrefix + "RELEASE"
+	envReleaseDir = dbtcommon.DbtEnvPrefix + "RELEASE_DIR"
+	envSQLDir     = dbtcommon.DbtEnvPrefix + "SQL_DIR"
+	envStepNo     = dbtcommon.DbtEnvPrefix + "STEP"
+	envStepCount  = dbtcommon.DbtEnvPrefix + "STEP_COUNT"
+	envDBName     = dbtcommon.DbtEnvPrefix + "DB_NAME"
+	envHook       = dbtcommon.DbtEnvPrefix + "HOOK"
+	envPGDatabase = "PGDATABASE"
+	envPGPrefix   = "PG"
+)
+
+// cleanEnvVars are the variables which are passed on to executable steps
+// from our environment when a clean environment is requested. In addition
+// any variables starting with the PG prefix are passed on.
+var cleanEnvVars = []string{
+	"HOME",
+	"LANG",
+	"LOGNAME",
+	"PATH",
+	"SHELL",
+	"TERM",
+	"TMPDIR",
+	"TZ",
+	"USER",
+}
+
+// envVarsNote returns the text of the note describing the environment
+// variables which are set for executable steps
+func envVarsNote() string {
+	return "Each executable step is run with its working directory set" +
+		" to the release directory and with the following environment" +
+		" variables set:\n" +
+		envRelease + ": the name of the release\n" +
+		envReleaseDir + ": the full pathname of the release directory\n" +
+		envSQLDir + ": the full pathname of the release SQL directory\n" +
+		envStepNo + ": the number of the step in the manifest," +
+		" starting at 1\n" +
+		envStepCount + ": the total number of steps in the manifest\n" +
+		envHook + ": the name of the hook file, for hook steps only\n" +
+		envDBName + " and " + envPGDatabase + ": the name of the" +
+		" database, if given\n" +
+		dbtcommon.DbtEnvPrefix + param.ConvertParamNameToEnvVarName(
+		dbtcommon.DbtBaseDirParamName) + ": the base directory\n" +
+		dbtcommon.DbtEnvPrefix + param.ConvertParamNameToEnvVarName(
+		dbtcommon.DbtPsqlPathParamName) + ": the psql command\n" +
+		"\n" +
+		"Any other PG... variables (such as PGHOST, PGPORT or PGUSER)" +
+		" are passed on unchanged so that the step can run psql" +
+		" without needing any connection details. If a clean" +
+		" environment is requested the only other variables passed" +
+		" on are: " + strings.Join(cleanEnvVars, ", ")
+}
+
+// absPath returns the absolute form of the pathname, or the pathname
+// unchanged if it cannot be made absolute
+func absPath(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+
+	return name
+}
+
+// stepEnv returns the environment for the given executable step
+func (prog *Prog) stepEnv(stepNo int) []string {
+	var env []string
+
+	if prog.cleanEnv {
+		for _, v := range os.Environ() {
+			name, _, _ := strings.Cut(v, "=")
+			if strings.HasPrefix(name, envPGPrefix) ||
+				slices.Contains(cleanEnvVars, name) {
+				env = append(env, v)
+			}
+		}
+	} else {
+		env = os.Environ()
+	}
+
+	// the step is run in the release directory so any relative pathnames
+	// must be made absolute
+	psqlPath := prog.dbp.PsqlPath
+	if strings.ContainsRune(psqlPath, filepath.Separator) {
+		psqlPath = absPath(psqlPath)
+	}
+
+	env = append(env,
+		dbtcommon.DbtEnvPrefix+param.ConvertParamNameToEnvVarName(
+			dbtcommon.DbtBaseDirParamName)+"="+absPath(prog.dbp.BaseDirName),
+		dbtcommon.DbtEnvPrefix+param.ConvertParamNameToEnvVarName(
+			dbtcommon.DbtPsqlPathParamName)+"="+psqlPath,
+		envRelease+"="+prog.releaseName,
+		envReleaseDir+"="+absPath(dbtcommon.DbtDirRelease(
+			prog.dbp.BaseDirName, prog.releaseName)),
+		envSQLDir+"="+absPath(dbtcommon.DbtDirReleaseSQL(
+			prog.dbp.BaseDirName, prog.releaseName)),
+		envStepNo+"="+strconv.Itoa(stepNo),
+		envStepCount+"="+strconv.Itoa(len(prog.runMf.Steps)),
+	)
+
+	if prog.dbp.DbName != "" {
+		env = append(env,
+			envDBName+"="+prog.dbp.DbName,
+			envPGDatabase+"="+prog.dbp.DbName)
+	}
+
+	return env
+}
+
+// stepCommand returns the command which will run the step. An SQL step
+// whose macros have been substituted is given the file holding the
+// resulting SQL, if it has been written (see writeScripts). An executable
+// step is run in the release directory with the environment set up to
+// describe the release and the step.
+func (prog *Prog) stepCommand(stepNo int, s *dbtcommon.Step) *exec.Cmd {
+	if s.IsSQL {
+		if sc := prog.scripts[s]; sc != nil && sc.file != "" {
+			return dbtcommon.SQLCommand(prog.dbp, sc.file)
+		}
+
+		return s.Command(prog.dbp)
+	}
+
+	cmd := exec.Command(absPath(s.File)) //nolint:gosec
+	cmd.Dir = dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, prog.releaseName)
+	cmd.Env = prog.stepEnv(stepNo)
+
+	return cmd
+}
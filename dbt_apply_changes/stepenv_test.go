@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestStepEnv(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+	t.Setenv("PGHOST", "dbhost")
+	t.Setenv("SOME_OTHER_VAR", "other")
+
+	baseDir := t.TempDir()
+	relDir := dbtcommon.DbtDirRelease(baseDir, testRelName)
+	sqlDir := dbtcommon.DbtDirReleaseSQL(baseDir, testRelName)
+
+	testCases := []struct {
+		testhelper.ID
+		cleanEnv bool
+		dbName   string
+		expSet   map[string]string
+		expUnset []string
+	}{
+		{
+			ID: testhelper.MkID("full environment, no database"),
+			expSet: map[string]string{
+				"HOME":           "/home/test",
+				"PGHOST":         "dbhost",
+				"SOME_OTHER_VAR": "other",
+				envRelease:       testRelName,
+				envReleaseDir:    relDir,
+				envSQLDir:        sqlDir,
+				envStepNo:        "2",
+				envStepCount:     "3",
+			},
+			expUnset: []string{envDBName},
+		},
+		{
+			ID:       testhelper.MkID("clean environment, with database"),
+			cleanEnv: true,
+			dbName:   "tenant_1",
+			expSet: map[string]string{
+				"HOME":        "/home/test",
+				"PGHOST":      "dbhost",
+				envRelease:    testRelName,
+				envStepNo:     "2",
+				envDBName:     "tenant_1",
+				envPGDatabase: "tenant_1",
+			},
+			expUnset: []string{"SOME_OTHER_VAR"},
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := NewProg()
+		prog.dbp.BaseDirName = baseDir
+		prog.dbp.DbName = tc.dbName
+		prog.cleanEnv = tc.cleanEnv
+		prog.setRelease(testRelName)
+		prog.runMf = &dbtcommon.Manifest{
+			Steps: make([]*dbtcommon.Step, 3),
+		}
+
+		env := prog.stepEnv(2)
+
+		// the last value set for a variable is the one used
+		vals := map[string]string{}
+
+		for _, v := range env {
+			name, val, _ := strings.Cut(v, "=")
+			vals[name] = val
+		}
+
+		for name, expVal := range tc.expSet {
+			val, ok := vals[name]
+			if !ok {
+				t.Errorf("%s: %s is not set", tc.IDStr(), name)
+				continue
+			}
+
+			testhelper.DiffString(t, tc.IDStr(), name, val, expVal)
+		}
+
+		for _, name := range tc.expUnset {
+			if _, ok := vals[name]; ok {
+				t.Errorf("%s: %s should not be set", tc.IDStr(), name)
+			}
+		}
+
+		if !filepath.IsAbs(vals[envReleaseDir]) {
+			t.Errorf("%s: %s should be an absolute pathname: %q",
+				tc.IDStr(), envReleaseDir, vals[envReleaseDir])
+		}
+
+		if tc.cleanEnv {
+			for name := range vals {
+				if strings.HasPrefix(name, envPGPrefix) ||
+					strings.HasPrefix(name, dbtcommon.DbtEnvPrefix) ||
+					slices.Contains(cleanEnvVars, name) {
+					continue
+				}
+
+				t.Errorf("%s: %s should not be passed in a clean environment",
+					tc.IDStr(), name)
+			}
+		}
+	}
+}
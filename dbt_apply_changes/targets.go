@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// noteTargets is the headline of the note describing how a release is
+// applied to several databases
+const noteTargets = "dbt_apply_changes - Targets"
+
+const (
+	targetFailStop     = "stop"
+	targetFailContinue = "continue"
+)
+
+// These are the outcomes reported for each target database
+const (
+	targetSucceeded = "succeeded"
+	targetFailed    = "failed"
+	targetSkipped   = "skipped"
+	targetNotRun    = "not run"
+)
+
+// targetNamePattern matches a valid target database name
+var targetNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// targetsNote returns the text of the note describing how a release is
+// applied to several databases
+func targetsNote() string {
+	return "A release can be applied to (or rolled back from) several" +
+		" databases, for instance where the same schema is used by" +
+		" many tenant databases. The databases can be given with the " +
+		paramNameTargets + " parameter or listed in a file given with" +
+		" the " + paramNameTargetsFile + " parameter, or both." +
+		"\n\n" +
+		"The targets file has one database name on each line. Blank" +
+		" lines are ignored as is anything after a '#'." +
+		"\n\n" +
+		"The " + dbtcommon.ReleaseReadMeFileName + " and " +
+		dbtcommon.ReleaseWarningFileName + " files are shown once," +
+		" before the release is applied to any database. Then each" +
+		" database is treated just as if it had been given with the" +
+		" database name parameter: it is locked, its approval is checked" +
+		" and its hooks are run. A database to which the release has" +
+		" already been applied is skipped. Each database has its own" +
+		" transcript which has the database name in the file name and" +
+		" which records the " + dbtcommon.ReleaseReadMeFileName + " and " +
+		dbtcommon.ReleaseWarningFileName + " files as they were shown" +
+		" and your response to the warning." +
+		"\n\n" +
+		"By default the databases are done one after another in the" +
+		" order given but several can be done at once by giving the " +
+		paramNameMaxTargets + " parameter. In that case the output for" +
+		" each database is shown when it has finished." +
+		"\n\n" +
+		"If the release fails for a database then, by default, it is not" +
+		" applied to any more databases, though any which are already" +
+		" being done are allowed to finish. Give the " +
+		paramNameOnTargetFailure + " parameter to change this." +
+		"\n\n" +
+		"Finally a table is shown giving the outcome for every database."
+}
+
+// targetResult records the outcome of applying the release to one target
+// database
+type targetResult struct {
+	dbName  string
+	outcome string
+	detail  string
+	errs    []error
+}
+
+// targetsFailed is the error returned when the release has not been
+// applied to all the target databases
+type targetsFailed struct {
+	failed int
+	notRun int
+	total  int
+	errs   []error
+}
+
+// Error returns a summary of the failures
+func (e targetsFailed) Error() string {
+	return fmt.Sprintf(
+		"the release was not applied to %d of %d databases:"+
+			" %d failed, %d not done",
+		e.failed+e.notRun, e.total, e.failed, e.notRun)
+}
+
+// Unwrap returns the errors for the individual databases so that the exit
+// status can reflect them
+func (e targetsFailed) Unwrap() []error {
+	return e.errs
+}
+
+// syncWriter serialises the writes to the underlying writer. It is used
+// for the collected output of a target database as the standard output and
+// standard error of a step are copied to it concurrently
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Write writes the data to the underlying writer
+func (sw *syncWriter) Write(data []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	return sw.w.Write(data)
+}
+
+// hasTargets returns true if the release is to be applied to target
+// databases rather than to a single database
+func (prog *Prog) hasTargets() bool {
+	return len(prog.targets) > 0 || prog.targetsFile != ""
+}
+
+// readTargetsFile reads the names of the target databases from the file.
+// It returns an error if any name is invalid
+func readTargetsFile(fileName string) ([]string, error) {
+	f, err := os.Open(fileName) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+
+	lineNo := 0
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+
+		name, _, _ := strings.Cut(scanner.Text(), "#")
+
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if !targetNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%s:%d: %q is not a valid database name",
+				fileName, lineNo, name)
+		}
+
+		names = append(names, name)
+	}
+
+	return names, scanner.Err()
+}
+
+// targetNames returns the names of the target databases. It returns an
+// error if the targets file cannot be read, if it gives no databases or if
+// any database is given more than once
+func (prog *Prog) targetNames() ([]string, error) {
+	names := slices.Clone(prog.targets)
+
+	if prog.targetsFile != "" {
+		fileNames, err := readTargetsFile(prog.targetsFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the targets file: %w", err)
+		}
+
+		if len(fileNames) == 0 {
+			return nil, fmt.Errorf("the targets file (%s) has no databases",
+				prog.targetsFile)
+		}
+
+		names = append(names, fileNames...)
+	}
+
+	seen := map[string]bool{}
+
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("the database %q is given more than once",
+				name)
+		}
+
+		seen[name] = true
+	}
+
+	return names, nil
+}
+
+// forTarget returns a copy of the program set up to apply the release to
+// the named database. The slices are copied so that the copy shares no
+// mutable state with the program, other than the record of what is
+// running which is shared by design
+func (prog *Prog) forTarget(dbName string) *Prog {
+	t := *prog
+
+	dbp := *prog.dbp
+	dbp.DbName = dbName
+	t.dbp = &dbp
+
+	t.macroDirs = slices.Clone(prog.macroDirs)
+	t.acceptWarning = slices.Clone(prog.acceptWarning)
+	t.reviewers = slices.Clone(prog.reviewers)
+	t.targets = slices.Clone(prog.targets)
+	t.shown = slices.Clone(prog.shown)
+
+	t.setRelease(prog.releaseName)
+	t.macroCache = nil
+	t.transcript = nil
+	t.target = true
+
+	return &t
+}
+
+// applyToTarget locks the database and applies the release to it unless it
+// has already been applied. It returns the outcome.
+func (prog *Prog) applyToTarget(ctx context.Context) targetResult {
+	res := targetResult{dbName: prog.dbp.DbName}
+
+	fail := func(errs ...error) targetResult {
+		res.outcome = targetFailed
+		res.errs = errs
+		res.detail, _, _ = strings.Cut(errs[0].Error(), "\n")
+
+		return res
+	}
+
+	lock, err := prog.lockDatabase(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer lock.release()
+
+	done, err := prog.releaseDone()
+	if err != nil {
+		return fail(err)
+	}
+
+	if done {
+		res.outcome = targetSkipped
+		res.detail = "already applied"
+
+		if prog.rollback {
+			res.detail = "already rolled back"
+		}
+
+		return res
+	}
+
+	if errs := prog.applyOneRelease(ctx); len(errs) > 0 {
+		return fail(errs...)
+	}
+
+	res.outcome = targetSucceeded
+
+	return res
+}
+
+// printTargetResult prints the outcome for the target and any errors
+func printTargetResult(res targetResult) {
+	fmt.Printf("Database %s: %s", res.dbName, res.outcome)
+
+	if res.outcome == targetSkipped {
+		fmt.Printf(" (%s)", res.detail)
+	}
+
+	fmt.Println()
+
+	for _, err := range res.errs {
+		fmt.Println(errorPrefix, err)
+	}
+}
+
+// printTargetSummary prints a table showing the outcome for each target
+func printTargetSummary(results []targetResult) {
+	fmt.Println()
+	fmt.Println("Summary:")
+
+	tw := newTableWriter()
+	fmt.Fprintln(tw, "DATABASE\tOUTCOME\tDETAIL")
+
+	for _, res := range results {
+		fmt.Fprintln(tw, res.dbName+"\t"+res.outcome+"\t"+res.detail)
+	}
+
+	_ = tw.Flush()
+}
+
+// applyToTargets applies the release to each of the target databases. The
+// release and its approval are checked for every target and then the
+// ReadMe and Warning are shown once before any target is started. What
+// is shown, together with the response to the Warning, is recorded in the
+// transcript for each target. A summary of the outcomes is shown at the
+// end. It returns an error if the release was not applied to every target
+func (prog *Prog) applyToTargets(ctx context.Context) error {
+	names, err := prog.targetNames()
+	if err != nil {
+		return err
+	}
+
+	if err := prog.checkTargets(names); err != nil {
+		return err
+	}
+
+	var shown bytes.Buffer
+
+	prog.transcript = newCapture(&shown)
+	prog.showReadMe()
+	prog.showWarning()
+	prog.transcript = nil
+	prog.shown = shown.Bytes()
+
+	results := prog.runTargets(ctx, names)
+
+	printTargetSummary(results)
+
+	return targetsError(ctx, results)
+}
+
+// checkTargets checks the release and its approval for each of the named
+// databases. This is done before the ReadMe and Warning are shown so that
+// the operator is not asked to confirm a release which cannot be applied.
+// It returns an error if the release cannot be applied to any of them
+func (prog *Prog) checkTargets(names []string) error {
+	var errs []error
+
+	for _, name := range names {
+		t := prog.forTarget(name)
+		t.quiet = true
+
+		if relErrs := t.checkRelease(); len(relErrs) > 0 {
+			return errors.Join(relErrs...)
+		}
+
+		if err := t.checkApproval(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// runTargets applies the release to each of the named databases and
+// returns the outcomes. Up to the maximum number of targets are done at
+// once and, if the release fails for any target and the policy is to stop,
+// no more targets are started. No more targets are started once the
+// program has been interrupted
+func (prog *Prog) runTargets(
+	ctx context.Context, names []string,
+) []targetResult {
+	results := make([]targetResult, len(names))
+	for i, name := range names {
+		results[i] = targetResult{dbName: name, outcome: targetNotRun}
+	}
+
+	collect := prog.maxTargets > 1 && len(names) > 1
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		stopped bool
+	)
+
+	sem := make(chan struct{}, prog.maxTargets)
+
+	for i, name := range names {
+		sem <- struct{}{}
+
+		mu.Lock()
+		stop := stopped || ctx.Err() != nil
+		mu.Unlock()
+
+		if stop {
+			break
+		}
+
+		t := prog.forTarget(name)
+
+		var buf bytes.Buffer
+
+		if collect {
+			t.console = &syncWriter{w: &buf}
+		} else {
+			fmt.Printf("\n=== Database %d of %d: %s\n", i+1, len(names), name)
+		}
+
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			res := t.applyToTarget(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			results[i] = res
+
+			if res.outcome == targetFailed &&
+				prog.onTargetFailure == targetFailStop {
+				stopped = true
+			}
+
+			if collect {
+				fmt.Printf("\n=== Database %d of %d: %s\n",
+					i+1, len(names), name)
+				_, _ = buf.WriteTo(os.Stdout)
+			}
+
+			printTargetResult(res)
+		})
+	}
+
+	wg.Wait()
+
+	for i, res := range results {
+		if res.outcome != targetNotRun {
+			continue
+		}
+
+		results[i].detail = "stopped after a failure"
+		if ctx.Err() != nil {
+			results[i].detail = "interrupted"
+		}
+	}
+
+	return results
+}
+
+// targetsError returns an error if the release was not applied to every
+// target or nil if it was
+func targetsError(ctx context.Context, results []targetResult) error {
+	e := targetsFailed{total: len(results)}
+
+	for _, res := range results {
+		switch res.outcome {
+		case targetFailed:
+			e.failed++
+			e.errs = append(e.errs, res.errs...)
+		case targetNotRun:
+			e.notRun++
+		}
+	}
+
+	if e.failed == 0 && e.notRun == 0 {
+		return nil
+	}
+
+	if cause := context.Cause(ctx); cause != nil {
+		e.errs = append(e.errs, cause)
+	}
+
+	return e
+}
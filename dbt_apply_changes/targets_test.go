@@ -0,0 +1,366 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+// fakeTargetPsql is a script standing in for psql. It gives the lock
+// whenever asked, reports that the release has been applied to the "done"
+// database and otherwise gives just enough output for the release to be
+// applied and recorded
+const fakeTargetPsql = `#!/bin/sh
+for a in "$@"
+do
+	case "$a" in
+	*RETURNING*) echo 1 ;;
+	*to_regclass*) echo t ;;
+	*"SELECT outcome"*)
+		case " $* " in *" -d done "*) echo success ;; esac ;;
+	esac
+done
+case "$*" in
+*" -c "*) ;;
+*"-f -"*) cat > /dev/null ;;
+*) read q; echo t; cat > /dev/null ;;
+esac
+exit 0
+`
+
+// targetsTestStep is a step which fails for the "bad" database
+const targetsTestStep = "#!/bin/sh\n" +
+	"[ \"$" + envDBName + "\" != bad ]\n"
+
+// targetsTestNoisyStep is a step which writes to both its standard output
+// and its standard error and fails for the "bad" database
+const targetsTestNoisyStep = "#!/bin/sh\n" +
+	"for i in 1 2 3 4 5 6 7 8 9 10\n" +
+	"do\n" +
+	"\techo \"out $i\"\n" +
+	"\techo \"err $i\" >&2\n" +
+	"done\n" +
+	"[ \"$" + envDBName + "\" != bad ]\n"
+
+// mkTargetsTestRelease creates a release with the given step, and a fake
+// psql, and returns a Prog set up to use them
+func mkTargetsTestRelease(t *testing.T, step string) *Prog {
+	t.Helper()
+
+	prog := mkTestRelease(t, map[string]string{
+		dbtcommon.ReleaseManifestFileName: "step.sh\n",
+		"step.sh":                         step,
+	})
+	prog.quiet = true
+	prog.noTranscript = true
+
+	relDir := dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, testRelName)
+
+	err := os.Chmod(filepath.Join(relDir, "step.sh"), 0o755) //nolint:gosec
+	if err != nil {
+		t.Fatal("cannot make the step executable:", err)
+	}
+
+	prog.dbp.PsqlPath = filepath.Join(t.TempDir(), "psql")
+
+	err = os.WriteFile(prog.dbp.PsqlPath, //nolint:gosec
+		[]byte(fakeTargetPsql), 0o755)
+	if err != nil {
+		t.Fatal("cannot write the fake psql:", err)
+	}
+
+	prog.updateSums = true
+	if errs := prog.parseManifest(); len(errs) > 0 {
+		t.Fatal("cannot parse the manifest:", errs)
+	}
+
+	if err := prog.updateChecksums(); err != nil {
+		t.Fatal("cannot set the checksums:", err)
+	}
+
+	prog.updateSums = false
+
+	return prog
+}
+
+func TestRunTargets(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		maxTargets  int
+		onFailure   string
+		step        string
+		targets     []string
+		expOutcomes []string
+	}{
+		{
+			ID:         testhelper.MkID("all succeed"),
+			maxTargets: 1,
+			onFailure:  targetFailStop,
+			targets:    []string{"a", "b"},
+			expOutcomes: []string{
+				targetSucceeded, targetSucceeded,
+			},
+		},
+		{
+			ID:         testhelper.MkID("stop on failure"),
+			maxTargets: 1,
+			onFailure:  targetFailStop,
+			targets:    []string{"a", "done", "bad", "c"},
+			expOutcomes: []string{
+				targetSucceeded, targetSkipped, targetFailed, targetNotRun,
+			},
+		},
+		{
+			ID:         testhelper.MkID("continue on failure, in parallel"),
+			maxTargets: 3,
+			onFailure:  targetFailContinue,
+			targets:    []string{"a", "bad", "done", "c", "d"},
+			expOutcomes: []string{
+				targetSucceeded, targetFailed, targetSkipped,
+				targetSucceeded, targetSucceeded,
+			},
+		},
+		{
+			ID:         testhelper.MkID("output on both streams, in parallel"),
+			maxTargets: 3,
+			onFailure:  targetFailContinue,
+			step:       targetsTestNoisyStep,
+			targets:    []string{"a", "bad", "c", "d"},
+			expOutcomes: []string{
+				targetSucceeded, targetFailed,
+				targetSucceeded, targetSucceeded,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		step := tc.step
+		if step == "" {
+			step = targetsTestStep
+		}
+
+		prog := mkTargetsTestRelease(t, step)
+		prog.maxTargets = tc.maxTargets
+		prog.onTargetFailure = tc.onFailure
+
+		results := prog.runTargets(context.Background(), tc.targets)
+
+		var outcomes []string
+		for _, res := range results {
+			outcomes = append(outcomes, res.outcome)
+		}
+
+		testhelper.DiffStringSlice(t, tc.IDStr(), "outcomes",
+			outcomes, tc.expOutcomes)
+	}
+}
+
+func TestTargetNames(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		targets  []string
+		fileText string
+		expNames []string
+	}{
+		{
+			ID:       testhelper.MkID("targets only"),
+			targets:  []string{"a", "b"},
+			expNames: []string{"a", "b"},
+		},
+		{
+			ID:       testhelper.MkID("targets and file"),
+			targets:  []string{"a"},
+			fileText: "# tenants\nt_1\n\n  t_2 # the second\n",
+			expNames: []string{"a", "t_1", "t_2"},
+		},
+		{
+			ID: testhelper.MkID("bad name in file"),
+			ExpErr: testhelper.MkExpErr("targets:2:",
+				`"Bad-Name" is not a valid database name`),
+			fileText: "t_1\nBad-Name\n",
+		},
+		{
+			ID:       testhelper.MkID("empty file"),
+			ExpErr:   testhelper.MkExpErr("has no databases"),
+			fileText: "# nothing here\n",
+		},
+		{
+			ID:       testhelper.MkID("duplicate"),
+			ExpErr:   testhelper.MkExpErr(`the database "a" is given more`),
+			targets:  []string{"a"},
+			fileText: "a\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := NewProg()
+		prog.targets = tc.targets
+
+		if tc.fileText != "" {
+			prog.targetsFile = filepath.Join(t.TempDir(), "targets")
+
+			err := os.WriteFile(prog.targetsFile, //nolint:gosec
+				[]byte(tc.fileText), 0o644)
+			if err != nil {
+				t.Fatal("cannot write the targets file:", err)
+			}
+		}
+
+		names, err := prog.targetNames()
+		if testhelper.CheckExpErr(t, err, tc) && err == nil {
+			testhelper.DiffStringSlice(t, tc.IDStr(), "names",
+				names, tc.expNames)
+		}
+	}
+}
+
+func TestForTarget(t *testing.T) {
+	prog := mkTestRelease(t, map[string]string{
+		dbtcommon.ReleaseManifestFileName: "step.sql\n",
+		"step.sql":                        "SELECT 1;\n",
+	})
+	prog.dbp.DbName = "orig"
+	prog.macroDirs = []string{"m1"}
+	prog.acceptWarning = []string{"w1"}
+	prog.reviewers = []string{"r1"}
+	prog.targets = []string{"a", "b"}
+	prog.shown = []byte("shown")
+
+	tgt := prog.forTarget("a")
+
+	testhelper.DiffString(t, "forTarget", "target database",
+		tgt.dbp.DbName, "a")
+	testhelper.DiffString(t, "forTarget", "original database",
+		prog.dbp.DbName, "orig")
+
+	tgt.macroDirs[0] = "changed"
+	tgt.acceptWarning[0] = "changed"
+	tgt.reviewers[0] = "changed"
+	tgt.targets[0] = "changed"
+	tgt.shown[0] = 'X'
+
+	testhelper.DiffStringSlice(t, "forTarget", "macroDirs",
+		prog.macroDirs, []string{"m1"})
+	testhelper.DiffStringSlice(t, "forTarget", "acceptWarning",
+		prog.acceptWarning, []string{"w1"})
+	testhelper.DiffStringSlice(t, "forTarget", "reviewers",
+		prog.reviewers, []string{"r1"})
+	testhelper.DiffStringSlice(t, "forTarget", "targets",
+		prog.targets, []string{"a", "b"})
+	testhelper.DiffString(t, "forTarget", "shown",
+		string(prog.shown), "shown")
+}
+
+func TestTargetsError(t *testing.T) {
+	stepErr := errors.New("step failed")
+
+	err := targetsError(context.Background(), []targetResult{
+		{dbName: "a", outcome: targetSucceeded},
+		{dbName: "b", outcome: targetSkipped},
+	})
+	if err != nil {
+		t.Error("unexpected error when every target succeeded:", err)
+	}
+
+	err = targetsError(context.Background(), []targetResult{
+		{dbName: "a", outcome: targetSucceeded},
+		{dbName: "b", outcome: targetFailed, errs: []error{stepErr}},
+		{dbName: "c", outcome: targetNotRun},
+	})
+	testhelper.CheckExpErr(t, err,
+		struct {
+			testhelper.ID
+			testhelper.ExpErr
+		}{
+			ID: testhelper.MkID("one failed, one not run"),
+			ExpErr: testhelper.MkExpErr(
+				"the release was not applied to 2 of 3 databases:" +
+					" 1 failed, 1 not done"),
+		})
+
+	if !errors.Is(err, stepErr) {
+		t.Error("the error should wrap the errors for the failed targets")
+	}
+}
+
+func TestApplyToTargetsTranscript(t *testing.T) {
+	const readMe = "This release adds the widgets table"
+
+	prog := mkTargetsTestRelease(t, targetsTestStep)
+	prog.quiet = false
+	prog.noTranscript = false
+	prog.transcriptDirName = t.TempDir()
+	prog.targets = []string{"a", "b"}
+
+	relDir := dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, testRelName)
+
+	err := os.WriteFile( //nolint:gosec
+		filepath.Join(relDir, dbtcommon.ReleaseReadMeFileName),
+		[]byte(readMe+"\n"), 0o644)
+	if err != nil {
+		t.Fatal("cannot write the ReadMe file:", err)
+	}
+
+	if err := prog.applyToTargets(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for _, name := range prog.targets {
+		files, err := filepath.Glob(filepath.Join(prog.transcriptDirName,
+			testRelName+"."+name+".*"+transcriptSuffix))
+		if err != nil || len(files) != 1 {
+			t.Errorf("database %s: expected one transcript, found: %v (%v)",
+				name, files, err)
+
+			continue
+		}
+
+		content, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal("cannot read the transcript:", err)
+		}
+
+		if !strings.Contains(string(content), readMe) {
+			t.Errorf("database %s: the transcript does not record the %s",
+				name, dbtcommon.ReleaseReadMeFileName)
+		}
+	}
+}
+
+func TestApplyToTargetsUnapproved(t *testing.T) {
+	prog := mkTargetsTestRelease(t, targetsTestStep)
+	prog.targets = []string{"dev", "prod_eu"}
+	prog.dbp.ApprovalRequiredFor = regexp.MustCompile("^prod")
+
+	relDir := dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, testRelName)
+
+	// The Warning would ask for confirmation if it were shown before the
+	// approval is checked
+	err := os.WriteFile( //nolint:gosec
+		filepath.Join(relDir, dbtcommon.ReleaseWarningFileName),
+		[]byte("This release drops a table\n"), 0o644)
+	if err != nil {
+		t.Fatal("cannot write the Warning file:", err)
+	}
+
+	testhelper.CheckExpErr(t, prog.applyToTargets(context.Background()),
+		struct {
+			testhelper.ID
+			testhelper.ExpErr
+		}{
+			ID: testhelper.MkID("one target needs approval"),
+			ExpErr: testhelper.MkExpErr(
+				`release "testRel" must be approved before it can be` +
+					` applied to the "prod_eu" database`),
+		})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// checkTransactionSteps checks that, if the release is to be run in a
+// single transaction, every step can take part in the transaction or is
+// marked as not to be run in the transaction.
+func (prog *Prog) checkTransactionSteps() []error {
+	if !prog.useTx() {
+		return nil
+	}
+
+	return prog.runMf.CheckTransactionSteps()
+}
+
+// txScript returns the psql script which will apply the given steps in a
+// single transaction. Each step's file is included in the script or, if
+// its macros have been substituted, the file holding the resulting SQL
+func (prog *Prog) txScript(steps []*dbtcommon.Step) string {
+	var script strings.Builder
+
+	script.WriteString("BEGIN;\n")
+
+	for _, s := range steps {
+		file := s.File
+		if sc := prog.scripts[s]; sc != nil && sc.file != "" {
+			file = sc.file
+		}
+
+		script.WriteString(`\i ` + dbtcommon.QuoteLiteral(file) + "\n")
+	}
+
+	script.WriteString("COMMIT;\n")
+
+	return script.String()
+}
+
+// runTxSteps applies the given SQL steps in a single psql session wrapped
+// in a transaction. If any step fails, or they take longer than the sum of
+// their timeouts, then none of the steps are committed.
+func (prog *Prog) runTxSteps(
+	ctx context.Context, steps []*dbtcommon.Step,
+) error {
+	removeScripts, err := prog.writeScripts(steps...)
+	if err != nil {
+		return err
+	}
+	defer removeScripts()
+
+	scripts := make([]*sqlScript, 0, len(steps))
+	for _, s := range steps {
+		scripts = append(scripts, prog.scripts[s])
+	}
+
+	errW := newPsqlErrWriter(prog.stderr(), scripts...)
+
+	cmd := dbtcommon.SQLCommand(prog.dbp, "-")
+	cmd.Stdin = strings.NewReader(prog.txScript(steps))
+	cmd.Stdout = prog.stdout()
+	cmd.Stderr = errW
+
+	names := stepNames(steps)
+	prog.running.setSteps(names)
+
+	desc := "transaction: " + names
+	start := prog.transcript.stepStart(desc)
+
+	err = runCmd(ctx, cmd, prog.groupTimeout(steps))
+
+	errW.Flush()
+	prog.transcript.stepEnd(desc, start, err)
+
+	if err != nil {
+		return fmt.Errorf("running the transaction (%s): %w - it has been"+
+			" rolled back",
+			names, err)
+	}
+
+	return nil
+}
+
+// txStepCount returns the number of consecutive steps, starting at the
+// given index, which should be run together in the release transaction. It
+// returns 0 if the release is not being run in a transaction or the step
+// at the index cannot be run in the transaction
+func (prog *Prog) txStepCount(idx int) int {
+	if !prog.useTx() {
+		return 0
+	}
+
+	count := 0
+
+	for _, s := range prog.runMf.Steps[idx:] {
+		if !s.InTx() {
+			break
+		}
+
+		count++
+	}
+
+	return count
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+// mkTxTestSteps returns steps of the kinds given by the codes: 's' for an
+// SQL step, 'n' for an SQL step which cannot be run in a transaction, 'x'
+// for an executable step and 'X' for an executable step which is marked
+// as not to be run in a transaction
+func mkTxTestSteps(codes string) []*dbtcommon.Step {
+	steps := make([]*dbtcommon.Step, 0, len(codes))
+
+	for i, c := range codes {
+		name := string(rune('a' + i))
+		s := &dbtcommon.Step{Name: name, File: "/rel/" + name}
+
+		switch c {
+		case 's':
+			s.IsSQL = true
+		case 'n':
+			s.IsSQL = true
+			s.NoTransaction = true
+		case 'X':
+			s.NoTransaction = true
+		}
+
+		steps = append(steps, s)
+	}
+
+	return steps
+}
+
+func TestTxStepCount(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		steps         string
+		inTransaction bool
+		mfTransaction bool
+		idx           int
+		expCount      int
+	}{
+		{
+			ID:       testhelper.MkID("no transaction"),
+			steps:    "sss",
+			expCount: 0,
+		},
+		{
+			ID:            testhelper.MkID("all SQL, transaction parameter"),
+			steps:         "sss",
+			inTransaction: true,
+			expCount:      3,
+		},
+		{
+			ID:            testhelper.MkID("all SQL, transaction directive"),
+			steps:         "sss",
+			mfTransaction: true,
+			expCount:      3,
+		},
+		{
+			ID:            testhelper.MkID("stops at an executable step"),
+			steps:         "ssxs",
+			inTransaction: true,
+			expCount:      2,
+		},
+		{
+			ID:            testhelper.MkID("stops at a no-transaction step"),
+			steps:         "snss",
+			inTransaction: true,
+			expCount:      1,
+		},
+		{
+			ID:            testhelper.MkID("starts at a no-transaction step"),
+			steps:         "snss",
+			inTransaction: true,
+			idx:           1,
+			expCount:      0,
+		},
+		{
+			ID:            testhelper.MkID("after an executable step"),
+			steps:         "ssxss",
+			inTransaction: true,
+			idx:           3,
+			expCount:      2,
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := NewProg()
+		prog.inTransaction = tc.inTransaction
+		prog.runMf = &dbtcommon.Manifest{
+			Steps:         mkTxTestSteps(tc.steps),
+			InTransaction: tc.mfTransaction,
+		}
+
+		testhelper.DiffInt(t, tc.IDStr(), "step count",
+			prog.txStepCount(tc.idx), tc.expCount)
+	}
+}
+
+func TestCheckTransactionSteps(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		steps         string
+		inTransaction bool
+	}{
+		{
+			ID:    testhelper.MkID("no transaction"),
+			steps: "sx",
+		},
+		{
+			ID:            testhelper.MkID("executable step marked"),
+			steps:         "snX",
+			inTransaction: true,
+		},
+		{
+			ID: testhelper.MkID("executable step not marked"),
+			ExpErr: testhelper.MkExpErr(
+				`"b" is an executable step which cannot take part in`),
+			steps:         "sx",
+			inTransaction: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := NewProg()
+		prog.inTransaction = tc.inTransaction
+		prog.runMf = &dbtcommon.Manifest{Steps: mkTxTestSteps(tc.steps)}
+
+		testhelper.CheckExpErr(t,
+			errors.Join(prog.checkTransactionSteps()...), tc)
+	}
+}
+
+func TestTxScript(t *testing.T) {
+	steps := mkTxTestSteps("sss")
+
+	expanded := &sqlScript{file: "/rel/.expanded.b"}
+	expanded.addLines("select 1;\nselect 2;", srcLine{file: "/rel/b", line: 1})
+
+	notWritten := &sqlScript{}
+	notWritten.addLines("select 3;", srcLine{file: "/rel/c", line: 1})
+
+	prog := NewProg()
+	prog.scripts = map[*dbtcommon.Step]*sqlScript{
+		steps[1]: expanded,
+		steps[2]: notWritten,
+	}
+
+	testhelper.DiffString(t, "txScript", "text", prog.txScript(steps),
+		"BEGIN;\n"+
+			`\i '/rel/a'`+"\n"+
+			`\i '/rel/.expanded.b'`+"\n"+
+			`\i '/rel/c'`+"\n"+
+			"COMMIT;\n")
+}
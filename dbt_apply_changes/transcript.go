@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+const (
+	transcriptTimeFmt = "20060102-150405"
+	transcriptSuffix  = ".log"
+	transcriptSep     = "----------------------------------------" +
+		"----------------------------------------\n"
+)
+
+// transcript records everything shown while a release is being applied,
+// including the output of every step, in a file. It is safe for
+// concurrent use and a nil transcript discards everything written to it
+type transcript struct {
+	mu   sync.Mutex
+	w    io.Writer
+	f    *os.File
+	name string
+}
+
+// newCapture returns a transcript which records everything written to it
+// in the buffer rather than in a file. This is used to capture what is
+// shown before the transcript files are opened
+func newCapture(buf *bytes.Buffer) *transcript {
+	return &transcript{w: buf}
+}
+
+// Write writes the data to the transcript file
+func (t *transcript) Write(data []byte) (int, error) {
+	if t == nil {
+		return len(data), nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.w.Write(data)
+}
+
+// printf writes the formatted text to the transcript file
+func (t *transcript) printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(t, format, args...)
+}
+
+// stepStart records the start of a step, or group of steps, and returns
+// the start time
+func (t *transcript) stepStart(desc string) time.Time {
+	start := time.Now()
+
+	t.stepStarted(desc, start)
+
+	return start
+}
+
+// stepStarted records that a step started at the given time. This is used
+// for steps whose output is captured and written to the transcript later
+func (t *transcript) stepStarted(desc string, start time.Time) {
+	t.printf("%s%s\nstarted: %s\n%s",
+		transcriptSep, desc, start.Format(time.RFC3339), transcriptSep)
+}
+
+// stepEnd records the end of a step, or group of steps, with its exit
+// status and how long it took
+func (t *transcript) stepEnd(desc string, start time.Time, err error) {
+	t.stepEnded(desc, start, time.Now(), err)
+}
+
+// stepEnded records that a step, started and ended at the given times,
+// has finished with the given error
+func (t *transcript) stepEnded(
+	desc string, start, end time.Time, err error,
+) {
+	status := "0"
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			status = fmt.Sprintf("%d (%s)", exitErr.ExitCode(), err)
+		} else {
+			status = err.Error()
+		}
+	}
+
+	t.printf("%s%s\nexit status: %s\nduration: %s\n%s",
+		transcriptSep, desc, status,
+		end.Sub(start).Round(time.Millisecond), transcriptSep)
+}
+
+// close records the outcome of the run and any errors and closes the
+// transcript file
+func (t *transcript) close(errs []error) {
+	if t == nil {
+		return
+	}
+
+	outcome := "success"
+
+	for _, err := range errs {
+		if err != nil {
+			outcome = "failure"
+
+			t.printf("%s %s\n", errorPrefix, err)
+		}
+	}
+
+	t.printf("%sfinished: %s\noutcome: %s\n",
+		transcriptSep, time.Now().Format(time.RFC3339), outcome)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.f != nil {
+		_ = t.f.Close()
+	}
+}
+
+// transcriptDir returns the directory where the transcript file should be
+// written
+func (prog *Prog) transcriptDir() string {
+	if prog.transcriptDirName != "" {
+		return prog.transcriptDirName
+	}
+
+	return filepath.Join(
+		dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, prog.releaseName),
+		dbtcommon.ReleaseTranscriptDirName)
+}
+
+// openTranscript creates the transcript file for this run of the release
+// and writes a header describing the run followed by anything which was
+// shown before the transcript was opened. Nothing is done if transcripts
+// have been turned off.
+func (prog *Prog) openTranscript() error {
+	if prog.noTranscript {
+		return nil
+	}
+
+	dir := prog.transcriptDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gosec
+		return fmt.Errorf("creating the transcript directory: %w", err)
+	}
+
+	now := time.Now()
+
+	action := "apply"
+	if prog.rollback {
+		action = "rollback"
+	}
+
+	relName := prog.releaseName
+	if prog.target {
+		relName += "." + prog.dbp.DbName
+	}
+
+	name := filepath.Join(dir,
+		relName+"."+now.Format(transcriptTimeFmt)+"."+action+
+			transcriptSuffix)
+
+	f, err := os.OpenFile(name, //nolint:gosec
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("creating the transcript file: %w", err)
+	}
+
+	prog.transcript = &transcript{w: f, f: f, name: name}
+
+	prog.transcript.printf("release:      %s\n"+
+		"action:       %s\n"+
+		"database:     %s\n"+
+		"user:         %s\n"+
+		"host:         %s\n"+
+		"tool-version: %s\n"+
+		"command:      %s\n"+
+		"started:      %s\n",
+		prog.releaseName, action, prog.dbp.DbName,
+		osUserName(), hostName(), dbtcommon.ToolVersion(),
+		strings.Join(os.Args, " "), now.Format(time.RFC3339))
+
+	if len(prog.shown) > 0 {
+		prog.transcript.printf("%s", prog.shown)
+	}
+
+	if !prog.quiet {
+		fmt.Fprintln(prog.screen(), "Transcript:", name)
+	}
+
+	return nil
+}
+
+// closeTranscript closes the transcript, if any, recording the errors
+func (prog *Prog) closeTranscript(errs []error) {
+	prog.transcript.close(errs)
+	prog.transcript = nil
+}
+
+// stdout returns the writer for normal output. This is the screen and the
+// transcript, if any.
+func (prog *Prog) stdout() io.Writer {
+	if prog.transcript == nil {
+		return prog.screen()
+	}
+
+	return io.MultiWriter(prog.screen(), prog.transcript)
+}
+
+// stderr returns the writer for error output. This is the standard error,
+// or the console if the output is being collected, and the transcript, if
+// any.
+func (prog *Prog) stderr() io.Writer {
+	w := io.Writer(os.Stderr)
+	if prog.console != nil {
+		w = prog.console
+	}
+
+	if prog.transcript == nil {
+		return w
+	}
+
+	return io.MultiWriter(w, prog.transcript)
+}
+
+// screen returns the writer for output which is not to be recorded in the
+// transcript. This is the standard output unless the output is being
+// collected
+func (prog *Prog) screen() io.Writer {
+	if prog.console != nil {
+		return prog.console
+	}
+
+	return os.Stdout
+}
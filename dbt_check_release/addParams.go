@@ -0,0 +1,35 @@
+package main
+
+// dbt_check_release
+
+import (
+	"github.com/nickwells/check.mod/v2/check"
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/param.mod/v7/param"
+	"github.com/nickwells/param.mod/v7/psetter"
+)
+
+func addParams(prog *Prog) param.PSetOptFunc {
+	return func(ps *param.PSet) error {
+		ps.Add("releases",
+			psetter.StrList[string]{
+				Value: &prog.releases,
+				Checks: []check.StringSlice{
+					check.SliceLength[[]string](check.ValGT(0)),
+					check.SliceHasNoDups[[]string, string],
+				},
+			},
+			"the names of the releases to check. If this is not given"+
+				" then every release in the release directory is checked"+
+				" (but not those in the "+
+				dbtcommon.ReleaseArchiveDirName+" directory)",
+			param.AltNames("release", "rel"),
+			param.Attrs(param.CommandLineOnly))
+
+		ps.Add("quiet", psetter.Bool{Value: &prog.quiet},
+			"only report the releases which have problems",
+			param.AltNames("q"))
+
+		return nil
+	}
+}
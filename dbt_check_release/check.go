@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// These are the names of the groups of problems in the report
+const (
+	grpReleaseDir = "Release directory"
+	grpManifest   = "Manifest files"
+	grpUnused     = "Unused files"
+	grpSteps      = "Steps"
+	grpDocs       = "ReadMe and Warning files"
+	grpApproval   = "Approval"
+	grpHooks      = "Hook files"
+)
+
+// problemGroup holds the problems of one type found in a release
+type problemGroup struct {
+	name     string
+	problems []error
+}
+
+// releaseReport holds the problems found in a release, grouped by type
+type releaseReport struct {
+	name   string
+	groups []problemGroup
+}
+
+// add records the problems against the named group. Nothing is recorded
+// if there are no problems
+func (rr *releaseReport) add(group string, errs ...error) {
+	if len(errs) == 0 {
+		return
+	}
+
+	for i := range rr.groups {
+		if rr.groups[i].name == group {
+			rr.groups[i].problems = append(rr.groups[i].problems, errs...)
+			return
+		}
+	}
+
+	rr.groups = append(rr.groups, problemGroup{name: group, problems: errs})
+}
+
+// problemCount returns the number of problems found in the release
+func (rr releaseReport) problemCount() int {
+	count := 0
+	for _, g := range rr.groups {
+		count += len(g.problems)
+	}
+
+	return count
+}
+
+// print prints the report. Nothing is printed for a release with no
+// problems if quiet is true
+func (rr releaseReport) print(quiet bool) {
+	count := rr.problemCount()
+	if count == 0 {
+		if !quiet {
+			fmt.Printf("%s: OK\n", rr.name)
+		}
+
+		return
+	}
+
+	problems := "problems"
+	if count == 1 {
+		problems = "problem"
+	}
+
+	fmt.Printf("%s: %d %s\n", rr.name, count, problems)
+
+	for _, g := range rr.groups {
+		fmt.Printf("\t%s:\n", g.name)
+
+		for _, p := range g.problems {
+			fmt.Printf("\t\t%s\n",
+				strings.ReplaceAll(p.Error(), "\n", "\n\t\t"))
+		}
+	}
+}
+
+// checkRelease checks the named release and returns the problems found
+func (prog *Prog) checkRelease(name string) releaseReport {
+	base := prog.dbp.BaseDirName
+	rr := releaseReport{name: name}
+
+	if err := dbtcommon.ReleaseDirIsOK(base, name); err != nil {
+		rr.add(grpReleaseDir, err)
+		return rr
+	}
+
+	mf, rollbackMf, errs := dbtcommon.ParseReleaseManifests(
+		base, name, false, true)
+	rr.add(grpManifest, errs...)
+
+	mfs := []*dbtcommon.Manifest{mf}
+	if rollbackMf != nil {
+		mfs = append(mfs, rollbackMf)
+	}
+
+	for _, m := range mfs {
+		if m.InTransaction {
+			rr.add(grpManifest, m.CheckTransactionSteps()...)
+		}
+	}
+
+	rr.add(grpUnused, dbtcommon.CheckForUnusedFiles(base, name, mfs...)...)
+	rr.add(grpSteps, checkSteps(mfs)...)
+	rr.add(grpDocs, checkDocs(base, name)...)
+
+	if len(errs) == 0 {
+		rr.add(grpApproval,
+			checkApproval(base, name, slices.Concat(mfs, prog.hooks))...)
+	}
+
+	return rr
+}
+
+// checkSteps checks the files run by the steps in the manifests. An
+// executable step must be executable and an SQL file must not be empty
+func checkSteps(mfs []*dbtcommon.Manifest) []error {
+	var errs []error
+
+	checked := map[string]bool{}
+
+	for _, mf := range mfs {
+		for _, s := range mf.Steps {
+			if checked[s.Name] {
+				continue
+			}
+
+			checked[s.Name] = true
+
+			info, err := os.Stat(s.File)
+			if err != nil {
+				errs = append(errs, s.Loc.Error(err.Error()))
+				continue
+			}
+
+			if s.IsSQL {
+				if info.Size() == 0 {
+					errs = append(errs,
+						s.Loc.Errorf("The SQL file %q is empty", s.Name))
+				}
+
+				continue
+			}
+
+			if info.Mode().Perm()&0o111 == 0 {
+				errs = append(errs,
+					s.Loc.Errorf("%q is not executable. Files outside"+
+						" the %s directory are run as programs",
+						s.Name, dbtcommon.ReleaseSQLDirName))
+			}
+		}
+	}
+
+	return errs
+}
+
+// checkDocs checks the files which describe the release. There must be a
+// ReadMe file with some content and a Warning file, if present, must not
+// be empty.
+func checkDocs(base, name string) []error {
+	var errs []error
+
+	readMe := dbtcommon.DbtFileReleaseReadMe(base, name)
+
+	info, err := os.Stat(readMe)
+
+	switch {
+	case os.IsNotExist(err):
+		errs = append(errs,
+			fmt.Errorf("there is no %s file. This should describe the"+
+				" release", dbtcommon.ReleaseReadMeFileName))
+	case err != nil:
+		errs = append(errs, err)
+	case info.Size() == 0:
+		errs = append(errs,
+			fmt.Errorf("the %s file is empty. It should describe the"+
+				" release", dbtcommon.ReleaseReadMeFileName))
+	}
+
+	warning := dbtcommon.DbtFileReleaseWarning(base, name)
+
+	info, err = os.Stat(warning)
+
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		errs = append(errs, err)
+	case info.Size() == 0:
+		errs = append(errs,
+			fmt.Errorf("the %s file is empty. It will not be shown and no"+
+				" confirmation will be asked for. Either describe the"+
+				" risk or remove the file",
+				dbtcommon.ReleaseWarningFileName))
+	}
+
+	return errs
+}
+
+// checkApproval checks that the approval of the release, if it has one,
+// is still valid. The manifests should include those of the hooks which
+// are run with the release. A release need not be approved
+func checkApproval(base, name string, mfs []*dbtcommon.Manifest) []error {
+	a, err := dbtcommon.ReadApproval(base, name)
+	if err != nil {
+		return []error{err}
+	}
+
+	if a == nil {
+		return nil
+	}
+
+	files, err := dbtcommon.ReleaseContents(base, name, mfs...)
+	if err != nil {
+		return []error{err}
+	}
+
+	if err := a.Check(name, files); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+const testRelName = "testRel"
+
+// mkTestRelease creates a release directory in a temporary base directory
+// containing the given files and returns a Prog set up to use it
+func mkTestRelease(t *testing.T, files map[string]string) *Prog {
+	t.Helper()
+
+	prog := NewProg()
+	prog.dbp.BaseDirName = t.TempDir()
+
+	relDir := dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, testRelName)
+
+	err := os.MkdirAll(relDir, 0o755) //nolint:gosec
+	if err != nil {
+		t.Fatal("cannot make the release directory:", err)
+	}
+
+	for name, content := range files {
+		fName := filepath.Join(relDir, name)
+
+		err := os.MkdirAll(filepath.Dir(fName), 0o755) //nolint:gosec
+		if err != nil {
+			t.Fatal("cannot make the release directory:", err)
+		}
+
+		err = os.WriteFile(fName, []byte(content), 0o644) //nolint:gosec
+		if err != nil {
+			t.Fatal("cannot make the release file:", err)
+		}
+	}
+
+	return prog
+}
+
+// mkExecutable makes the named files in the test release executable
+func mkExecutable(t *testing.T, prog *Prog, names ...string) {
+	t.Helper()
+
+	relDir := dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, testRelName)
+
+	for _, name := range names {
+		err := os.Chmod(filepath.Join(relDir, name), 0o755) //nolint:gosec
+		if err != nil {
+			t.Fatal("cannot make the file executable:", err)
+		}
+	}
+}
+
+func TestCheckRelease(t *testing.T) {
+	const readMe = "describes the release\n"
+
+	testCases := []struct {
+		testhelper.ID
+		files       map[string]string
+		executables []string
+		expGroups   map[string]int
+	}{
+		{
+			ID: testhelper.MkID("good release"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\nrun.sh\n",
+				dbtcommon.ReleaseRollbackFileName: "SQL.files/undo.sql\n",
+				dbtcommon.ReleaseReadMeFileName:   readMe,
+				"SQL.files/a.sql":                 "select 1;\n",
+				"SQL.files/undo.sql":              "select 2;\n",
+				"run.sh":                          "#!/bin/sh\n",
+			},
+			executables: []string{"run.sh"},
+			expGroups:   map[string]int{},
+		},
+		{
+			ID: testhelper.MkID("bad manifest and unused file"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql bad-attr\n",
+				dbtcommon.ReleaseReadMeFileName:   readMe,
+				"SQL.files/a.sql":                 "select 1;\n",
+			},
+			expGroups: map[string]int{
+				grpManifest: 2,
+				grpUnused:   1,
+			},
+		},
+		{
+			ID: testhelper.MkID("bad steps"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/empty.sql\n" +
+					"run.sh\n",
+				dbtcommon.ReleaseReadMeFileName: readMe,
+				"SQL.files/empty.sql":           "",
+				"run.sh":                        "#!/bin/sh\n",
+			},
+			expGroups: map[string]int{
+				grpSteps: 2,
+			},
+		},
+		{
+			ID: testhelper.MkID("executable step in a transaction"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "@transaction\n" +
+					"SQL.files/a.sql\n" +
+					"run.sh\n",
+				dbtcommon.ReleaseReadMeFileName: readMe,
+				"SQL.files/a.sql":               "select 1;\n",
+				"run.sh":                        "#!/bin/sh\n",
+			},
+			executables: []string{"run.sh"},
+			expGroups: map[string]int{
+				grpManifest: 1,
+			},
+		},
+		{
+			ID: testhelper.MkID("no ReadMe and an empty Warning"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n",
+				dbtcommon.ReleaseWarningFileName:  "",
+				"SQL.files/a.sql":                 "select 1;\n",
+			},
+			expGroups: map[string]int{
+				grpDocs: 2,
+			},
+		},
+		{
+			ID: testhelper.MkID("stale approval"),
+			files: map[string]string{
+				dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n",
+				dbtcommon.ReleaseApprovalFileName: "release: " +
+					testRelName + "\n" +
+					"approved: 2026-01-02T10:00:00Z\n" +
+					"reviewer: alice\n" +
+					"file: " + strings.Repeat("0", 64) +
+					" SQL.files/a.sql\n",
+				dbtcommon.ReleaseReadMeFileName: readMe,
+				"SQL.files/a.sql":               "select 1;\n",
+			},
+			expGroups: map[string]int{
+				grpApproval: 1,
+			},
+		},
+		{
+			ID: testhelper.MkID("no manifest"),
+			files: map[string]string{
+				dbtcommon.ReleaseReadMeFileName: readMe,
+			},
+			expGroups: map[string]int{
+				grpManifest: 2,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := mkTestRelease(t, tc.files)
+		mkExecutable(t, prog, tc.executables...)
+
+		rr := prog.checkRelease(testRelName)
+
+		groups := map[string]int{}
+		for _, g := range rr.groups {
+			groups[g.name] = len(g.problems)
+		}
+
+		for name, count := range tc.expGroups {
+			testhelper.DiffInt(t, tc.IDStr(), name, groups[name], count)
+		}
+
+		for name, count := range groups {
+			if _, ok := tc.expGroups[name]; !ok {
+				t.Log(tc.IDStr())
+				t.Errorf("\t: unexpected %s problems: %d: %v",
+					name, count, rr.groups)
+			}
+		}
+	}
+}
+
+func TestCheckReleaseMissing(t *testing.T) {
+	prog := mkTestRelease(t, nil)
+
+	rr := prog.checkRelease("nonesuch")
+
+	testhelper.DiffInt(t, "missing release", "problem count",
+		rr.problemCount(), 1)
+
+	if len(rr.groups) == 1 {
+		testhelper.DiffString(t, "missing release", "group",
+			rr.groups[0].name, grpReleaseDir)
+	}
+}
+
+func TestCheckReservedRelease(t *testing.T) {
+	prog := mkTestRelease(t, map[string]string{
+		dbtcommon.ReleaseManifestFileName: "SQL.files/a.sql\n",
+		"SQL.files/a.sql":                 "select 1;\n",
+		"../Common/Manifest":              "SQL.files/b.sql\n",
+		"../Common/SQL.files/b.sql":       "select 2;\n",
+		"../Hooks/PreRelease":             "pre.sh\n",
+	})
+
+	releases, err := dbtcommon.FindReleases(prog.dbp.BaseDirName)
+	if err != nil {
+		t.Fatal("cannot find the releases:", err)
+	}
+
+	testhelper.DiffStringSlice(t, "reserved release", "releases",
+		releases,
+		[]string{dbtcommon.ReleaseCommonDirName, testRelName})
+
+	rr := prog.checkRelease(dbtcommon.ReleaseCommonDirName)
+
+	testhelper.DiffInt(t, "reserved release", "problem count",
+		rr.problemCount(), 1)
+
+	if len(rr.groups) == 1 && len(rr.groups[0].problems) == 1 {
+		testhelper.DiffString(t, "reserved release", "group",
+			rr.groups[0].name, grpReleaseDir)
+		testhelper.DiffBool(t, "reserved release", "says it is reserved",
+			strings.Contains(rr.groups[0].problems[0].Error(),
+				"the name is reserved for Manifest fragments"), true)
+	}
+}
+
+func TestCheckHooks(t *testing.T) {
+	prog := mkTestRelease(t, map[string]string{
+		"../Hooks/PreRelease":      "backup.sh\n",
+		"../Hooks/backup.sh":       "#!/bin/sh\n",
+		"../Hooks/old.sh":          "#!/bin/sh\n",
+		"../Hooks/dev/PostRelease": "nonesuch.sh\n",
+	})
+	mkExecutable(t, prog, "../Hooks/backup.sh")
+
+	rr := prog.checkHooks()
+
+	testhelper.DiffInt(t, "hooks", "hook files", len(prog.hooks), 1)
+	testhelper.DiffInt(t, "hooks", "problem count", rr.problemCount(), 1)
+
+	if len(rr.groups) == 1 {
+		testhelper.DiffString(t, "hooks", "group",
+			rr.groups[0].name, grpUnused)
+	}
+}
@@ -0,0 +1,11 @@
+/*
+dbt_check_release is a command which checks that one or more release
+directories are correctly organised without needing a database. It reports
+problems such as errors in the Manifest and Rollback files, files which are
+not in either manifest, executable steps which cannot be run, empty SQL
+files and a missing ReadMe file. The hook files, which are run with every
+release, and the files in the hooks directories are checked too. It exits
+with a non-zero status if any problems are found so that it can be used as
+a check on any change to the release scripts.
+*/
+package main
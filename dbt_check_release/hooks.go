@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// checkHooks parses the hook files which are run with every release
+// applied to the database, recording their manifests so that they can be
+// included when the approval of a release is checked. It also checks for
+// unused files in the hooks directories. It returns a report of any
+// problems found
+func (prog *Prog) checkHooks() releaseReport {
+	base := prog.dbp.BaseDirName
+	rr := releaseReport{name: dbtcommon.ReleaseHooksDirName}
+
+	for _, hook := range dbtcommon.HookFileNames {
+		fileName := dbtcommon.FindHookFile(base, prog.dbp.DbName, hook)
+		if fileName == "" {
+			continue
+		}
+
+		mf, errs := dbtcommon.ParseHookFile(base, fileName, true)
+		rr.add(grpHooks, errs...)
+		rr.add(grpSteps, checkSteps([]*dbtcommon.Manifest{mf})...)
+
+		prog.hooks = append(prog.hooks, mf)
+	}
+
+	rr.add(grpUnused,
+		dbtcommon.CheckForUnusedHookFiles(base, prog.dbp.DbName)...)
+
+	return rr
+}
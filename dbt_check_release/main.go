@@ -0,0 +1,78 @@
+package main
+
+// dbt_check_release
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// Created: Sun Oct 18 10:12:31 2026
+
+// Prog holds program parameter values etc.
+type Prog struct {
+	releases []string
+	quiet    bool
+	dbp      *dbtcommon.DBParams
+
+	// hooks holds the manifests of the hooks which are run with every
+	// release
+	hooks []*dbtcommon.Manifest
+}
+
+// NewProg returns a new Prog value, correctly initialised
+func NewProg() *Prog {
+	return &Prog{
+		dbp: dbtcommon.NewDBParams(),
+	}
+}
+
+func main() {
+	prog := NewProg()
+	ps := makeParamSet(prog)
+	ps.Parse()
+
+	releases := prog.releases
+	if len(releases) == 0 {
+		var err error
+
+		releases, err = dbtcommon.FindReleases(prog.dbp.BaseDirName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't find the releases: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	hooksReport := prog.checkHooks()
+	hooksReport.print(prog.quiet || len(prog.hooks) == 0)
+
+	var badCount int
+
+	for _, r := range releases {
+		rr := prog.checkRelease(r)
+		rr.print(prog.quiet)
+
+		if rr.problemCount() > 0 {
+			badCount++
+		}
+	}
+
+	if hooksReport.problemCount() > 0 {
+		fmt.Println("the hook files have problems")
+	}
+
+	if badCount > 0 {
+		fmt.Printf("%d of %d releases have problems\n",
+			badCount, len(releases))
+	}
+
+	if badCount > 0 || hooksReport.problemCount() > 0 {
+		os.Exit(1)
+	}
+
+	if !prog.quiet {
+		fmt.Printf("all %d releases are OK\n", len(releases))
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/param.mod/v7/param"
+	"github.com/nickwells/param.mod/v7/paramset"
+	"github.com/nickwells/versionparams.mod/versionparams"
+)
+
+// makeParamSet generates the param set ready for parsing
+func makeParamSet(prog *Prog) *param.PSet {
+	return paramset.New(
+		addParams(prog),
+		versionparams.AddParams,
+		dbtcommon.AddParams(prog.dbp),
+		param.SetProgramDescription("this will check that releases are"+
+			" correctly organised without applying them. No database is"+
+			" needed. The problems found are reported, grouped by"+
+			" release and by the type of problem, and the program exits"+
+			" with a non-zero status if there are any problems"),
+	)
+}
@@ -44,15 +44,7 @@ func addParams(prog *Prog) param.PSetOptFunc {
 				" functions and types (in subdirectories of the same names)",
 		)
 
-		ps.Add("macro-dirs",
-			psetter.StrList[string]{
-				Value: &prog.macroDirs,
-				Checks: []check.ValCk[[]string]{
-					check.SliceLength[[]string](check.ValGT(0)),
-					check.SliceHasNoDups[[]string, string],
-				},
-			},
-			"a list of additional directories in which macros may be found")
+		dbtcommon.AddParamMacroDirs(&prog.macroDirs, ps)
 
 		schemaObjNameCheck := check.SliceAll[[]string](
 			check.StringMatchesPattern[string](
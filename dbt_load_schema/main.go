@@ -213,12 +213,7 @@ func (prog *Prog) applyAllFiles() {
 func (prog *Prog) makeMacroCache() {
 	verbose.Println("construct the Macro cache")
 
-	prog.macroDirs = append(prog.macroDirs,
-		dbtcommon.DbtDirMacros(prog.dbp.BaseDirName))
-
-	mc, err := macros.NewCache(
-		macros.Dirs(prog.macroDirs...),
-		macros.Suffix(".sql"))
+	mc, err := dbtcommon.NewMacroCache(prog.dbp, prog.macroDirs)
 	if err != nil {
 		fmt.Println("Couldn't construct the macro cache: ", err)
 		os.Exit(1)
@@ -0,0 +1,95 @@
+package main
+
+// dbt_new_release
+
+import (
+	"regexp"
+
+	"github.com/nickwells/check.mod/v2/check"
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/param.mod/v7/param"
+	"github.com/nickwells/param.mod/v7/psetter"
+)
+
+const (
+	paramNameSlug     = "slug"
+	paramNamePrefix   = "prefix"
+	paramNameSeqWidth = "sequence-width"
+)
+
+func addParams(prog *Prog) param.PSetOptFunc {
+	return func(ps *param.PSet) error {
+		ps.Add(paramNameSlug,
+			psetter.String[string]{
+				Value: &prog.slug,
+				Checks: []check.ValCk[string]{
+					check.StringMatchesPattern[string](slugPattern,
+						"a short description of the release: lowercase"+
+							" letters and digits, in words separated by"+
+							" single hyphens or underscores"),
+				},
+			},
+			"a short description of the release. This is added after"+
+				" the prefix to give the name of the release",
+			param.AltNames("name", "description"),
+			param.Attrs(param.MustBeSet|param.CommandLineOnly),
+			param.SeeAlso(paramNamePrefix))
+
+		ps.Add(paramNamePrefix,
+			psetter.Enum[string]{
+				Value: &prog.prefixStyle,
+				AllowedVals: psetter.AllowedVals[string]{
+					prefixDate: "the date (as " + prefixDateFmt + ")",
+					prefixSequence: "the number one greater than the" +
+						" largest sequence number at the start of the name" +
+						" of any release, including those in the " +
+						dbtcommon.ReleaseArchiveDirName + " directory." +
+						" Only numbers with the " + paramNameSeqWidth +
+						" number of digits (or more, without leading" +
+						" zeros) are counted; date prefixes are ignored",
+				},
+			},
+			"the style of prefix which starts the name of the release."+
+				" The prefix is separated from the "+paramNameSlug+
+				" by '"+nameSep+"'. This would typically be set in a"+
+				" configuration file so that all the releases are named"+
+				" in the same way",
+			param.AltNames("name-style"),
+			param.SeeAlso(paramNameSeqWidth))
+
+		ps.Add(paramNameSeqWidth,
+			psetter.Int[int]{
+				Value: &prog.seqWidth,
+				Checks: []check.ValCk[int]{
+					check.ValBetween[int](1, 10),
+				},
+			},
+			"the minimum number of digits in a sequence number prefix."+
+				" Shorter numbers have leading zeros added so that the"+
+				" releases are listed in order",
+			param.SeeAlso(paramNamePrefix))
+
+		ps.Add("sql-files",
+			psetter.StrList[string]{
+				Value: &prog.sqlFiles,
+				Checks: []check.StringSlice{
+					check.SliceAll[[]string](
+						check.StringMatchesPattern[string](
+							regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$`),
+							"an SQL file name: letters, digits,"+
+								" underscores, hyphens and dots, not"+
+								" starting with a hyphen or dot")),
+					check.SliceHasNoDups[[]string, string],
+				},
+			},
+			"the names of SQL files to create in the "+
+				dbtcommon.ReleaseSQLDirName+" directory. They are added"+
+				" to the "+dbtcommon.ReleaseManifestFileName+" file in"+
+				" the order given. The '"+sqlFileSuffix+"' suffix is"+
+				" added if it is missing",
+			param.AltNames("sql"),
+			param.Attrs(param.CommandLineOnly))
+
+		return nil
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/nickwells/filecheck.mod/filecheck"
+	"github.com/nickwells/param.mod/v7/param"
+	"github.com/nickwells/xdg.mod/xdg"
+)
+
+// configFileName returns the name of the program config file in the given
+// base directory
+func configFileName(baseDir string) string {
+	return filepath.Join(baseDir,
+		"github.com",
+		"nickwells",
+		"dbtools",
+		"dbt_new_release",
+		"common.cfg")
+}
+
+// setGlobalConfigFile adds the system-wide config file, if there is one,
+// to the set which the param parser will process. This can be used to
+// give the naming convention for all the releases
+func setGlobalConfigFile(ps *param.PSet) error {
+	dirs := xdg.ConfigDirs()
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	ps.AddConfigFileStrict(configFileName(dirs[0]), filecheck.Optional)
+
+	return nil
+}
+
+// setConfigFile adds the personal config file, if there is one, to the set
+// which the param parser will process. It is added after the global config
+// file so that personal choices override the system-wide defaults
+func setConfigFile(ps *param.PSet) error {
+	ps.AddConfigFileStrict(configFileName(xdg.ConfigHome()),
+		filecheck.Optional)
+
+	return nil
+}
@@ -0,0 +1,9 @@
+/*
+dbt_new_release is a command which creates a new, correctly structured
+release directory. The release name is made from a prefix (the date or the
+next number in sequence) and a short description. The directory is created
+with a Manifest file describing how it should be filled in, a ReadMe file
+to be completed and, optionally, some initial SQL files which are added to
+the Manifest in the order given.
+*/
+package main
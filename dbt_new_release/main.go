@@ -0,0 +1,75 @@
+package main
+
+// dbt_new_release
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// Created: Sun Oct 18 14:05:52 2026
+
+// Prog holds program parameter values etc.
+type Prog struct {
+	slug        string
+	prefixStyle string
+	seqWidth    int
+	sqlFiles    []string
+	dbp         *dbtcommon.DBParams
+}
+
+// NewProg returns a new Prog value, correctly initialised
+func NewProg() *Prog {
+	const dfltSeqWidth = 4
+
+	return &Prog{
+		prefixStyle: prefixSequence,
+		seqWidth:    dfltSeqWidth,
+		dbp:         dbtcommon.NewDBParams(),
+	}
+}
+
+func main() {
+	prog := NewProg()
+	ps := makeParamSet(prog)
+	ps.Parse()
+
+	relBase := dbtcommon.DbtDirReleaseBase(prog.dbp.BaseDirName)
+	if _, err := os.Stat(relBase); err != nil {
+		fmt.Fprintf(os.Stderr, "The release directory is missing: %s\n", err)
+		os.Exit(1)
+	}
+
+	existing, err := prog.existingReleases()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't find the existing releases: %s\n",
+			err)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+
+	relName, err := prog.makeReleaseName(existing, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't name the release: %s\n", err)
+		os.Exit(1)
+	}
+
+	files, err := prog.createRelease(relName, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't create the release: %s\n", err)
+		os.Exit(1)
+	}
+
+	relDir := dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, relName)
+
+	fmt.Println("Release created:", relDir)
+
+	for _, f := range files {
+		fmt.Println("\t" + filepath.Join(relDir, f))
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// These are the styles of prefix which can start the release name
+const (
+	prefixDate     = "date"
+	prefixSequence = "sequence"
+)
+
+// prefixDateFmt is the format of the date used as the release name prefix
+const prefixDateFmt = "20060102"
+
+// nameSep separates the prefix of the release name from the slug
+const nameSep = "-"
+
+// slugPattern matches a valid slug: lowercase letters and digits, in words
+// separated by single hyphens or underscores
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+([-_][a-z0-9]+)*$`)
+
+// existingReleases returns a map of the names of all the releases, both
+// those in the release directory and those which have been archived, to a
+// description of where they are
+func (prog *Prog) existingReleases() (map[string]string, error) {
+	existing := map[string]string{}
+
+	archived, err := dbtcommon.FindArchivedReleases(prog.dbp.BaseDirName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ar := range archived {
+		existing[ar.Name] = "in the " + dbtcommon.ReleaseArchiveDirName +
+			" directory as " + ar.DirName
+	}
+
+	releases, err := dbtcommon.FindReleases(prog.dbp.BaseDirName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range releases {
+		existing[r] = "in the release directory"
+	}
+
+	return existing, nil
+}
+
+// isSequencePrefix returns true if the prefix of a release name is in the
+// sequence style for the given width. That is, it is followed by the name
+// separator and is at least the given width. A prefix which is longer than
+// the width must not have leading zeros. A prefix which is a valid date in
+// the date style is not a sequence number.
+func isSequencePrefix(name, prefix string, width int) bool {
+	if prefix == "" || !strings.HasPrefix(name[len(prefix):], nameSep) {
+		return false
+	}
+
+	if len(prefix) < width {
+		return false
+	}
+
+	if len(prefix) > width && prefix[0] == '0' {
+		return false
+	}
+
+	if len(prefix) == len(prefixDateFmt) {
+		if _, err := time.Parse(prefixDateFmt, prefix); err == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nextSequence returns the number which is one greater than the largest
+// sequence-style prefix, of the given width, of any of the release names.
+// If no release name has such a prefix then 1 is returned.
+func nextSequence(existing map[string]string, width int) int {
+	highest := 0
+
+	for name := range existing {
+		prefix := dbtcommon.ReleaseNumericPrefix(name)
+		if !isSequencePrefix(name, prefix, width) {
+			continue
+		}
+
+		n, err := strconv.Atoi(prefix)
+		if err == nil && n > highest {
+			highest = n
+		}
+	}
+
+	return highest + 1
+}
+
+// makeReleaseName returns the name of the new release, made from the
+// prefix and the slug. It is an error if there is already a release with
+// that name, whether or not it has been archived.
+func (prog *Prog) makeReleaseName(
+	existing map[string]string, now time.Time,
+) (string, error) {
+	var prefix string
+
+	switch prog.prefixStyle {
+	case prefixDate:
+		prefix = now.Format(prefixDateFmt)
+	case prefixSequence:
+		seq := nextSequence(existing, prog.seqWidth)
+		prefix = fmt.Sprintf("%0*d", prog.seqWidth, seq)
+	}
+
+	name := prefix + nameSep + prog.slug
+
+	if where, ok := existing[name]; ok {
+		return "", fmt.Errorf("there is already a release called %q (%s)",
+			name, where)
+	}
+
+	return name, nil
+}
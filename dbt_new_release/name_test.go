@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestNextSequence(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		names  []string
+		width  int
+		expSeq int
+	}{
+		{
+			ID:     testhelper.MkID("no releases"),
+			width:  4,
+			expSeq: 1,
+		},
+		{
+			ID:     testhelper.MkID("no numeric prefixes"),
+			names:  []string{"a", "b-2"},
+			width:  4,
+			expSeq: 1,
+		},
+		{
+			ID:     testhelper.MkID("mixed"),
+			names:  []string{"2-a", "0010-b", "9-c", "x-11"},
+			width:  1,
+			expSeq: 10,
+		},
+		{
+			ID:     testhelper.MkID("date prefixes are ignored"),
+			names:  []string{"0003-a", "20261018-x", "0004-b"},
+			width:  4,
+			expSeq: 5,
+		},
+		{
+			ID:     testhelper.MkID("other widths are ignored"),
+			names:  []string{"0003-a", "12-b", "000099-c"},
+			width:  4,
+			expSeq: 4,
+		},
+		{
+			ID:     testhelper.MkID("wider than the width"),
+			names:  []string{"9999-a", "10000-b"},
+			width:  4,
+			expSeq: 10001,
+		},
+		{
+			ID:     testhelper.MkID("not followed by the separator"),
+			names:  []string{"0003-a", "0100x-b", "0200"},
+			width:  4,
+			expSeq: 4,
+		},
+	}
+
+	for _, tc := range testCases {
+		existing := map[string]string{}
+		for _, n := range tc.names {
+			existing[n] = "test"
+		}
+
+		testhelper.DiffInt(t, tc.IDStr(), "next sequence",
+			nextSequence(existing, tc.width), tc.expSeq)
+	}
+}
+
+func TestMakeReleaseName(t *testing.T) {
+	now := time.Date(2026, time.March, 4, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		prefixStyle string
+		seqWidth    int
+		slug        string
+		existing    map[string]string
+		expName     string
+	}{
+		{
+			ID:          testhelper.MkID("date"),
+			prefixStyle: prefixDate,
+			slug:        "add_users",
+			expName:     "20260304-add_users",
+		},
+		{
+			ID:          testhelper.MkID("sequence, padded"),
+			prefixStyle: prefixSequence,
+			seqWidth:    4,
+			slug:        "add_users",
+			existing:    map[string]string{"0041-x": "here", "7-y": "there"},
+			expName:     "0042-add_users",
+		},
+		{
+			ID:          testhelper.MkID("sequence, wider than the width"),
+			prefixStyle: prefixSequence,
+			seqWidth:    1,
+			slug:        "a",
+			existing:    map[string]string{"99-x": "here"},
+			expName:     "100-a",
+		},
+		{
+			ID: testhelper.MkID("name in use"),
+			ExpErr: testhelper.MkExpErr(
+				`there is already a release called "20260304-a"`,
+				"in the Archive directory"),
+			prefixStyle: prefixDate,
+			slug:        "a",
+			existing: map[string]string{
+				"20260304-a": "in the Archive directory as x",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		prog := NewProg()
+		prog.prefixStyle = tc.prefixStyle
+		prog.seqWidth = tc.seqWidth
+		prog.slug = tc.slug
+
+		name, err := prog.makeReleaseName(tc.existing, now)
+		if testhelper.CheckExpErr(t, err, tc) && err == nil {
+			testhelper.DiffString(t, tc.IDStr(), "name", name, tc.expName)
+		}
+	}
+}
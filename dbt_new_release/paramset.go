@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/param.mod/v7/param"
+	"github.com/nickwells/param.mod/v7/paramset"
+	"github.com/nickwells/versionparams.mod/versionparams"
+)
+
+// makeParamSet generates the param set ready for parsing
+func makeParamSet(prog *Prog) *param.PSet {
+	return paramset.New(
+		addParams(prog),
+		versionparams.AddParams,
+		dbtcommon.AddParams(prog.dbp),
+		setGlobalConfigFile,
+		setConfigFile,
+		param.SetProgramDescription("this will create a new release"+
+			" directory with the files needed to start writing the"+
+			" release. The name of the release is made from a prefix"+
+			" and a short description of the release. The style of"+
+			" the prefix can be set in a configuration file so that"+
+			" all the releases are named in the same way"),
+	)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+)
+
+// sqlFileSuffix is the suffix given to the initial SQL files
+const sqlFileSuffix = ".sql"
+
+// manifestTemplate returns the contents of the Manifest file for the new
+// release. The comments describe how the file should be filled in and the
+// SQL files, if any, are listed in order.
+func manifestTemplate(relName string, sqlFiles []string) string {
+	var mf strings.Builder
+
+	fmt.Fprintf(&mf, "# %s file for release: %s\n",
+		dbtcommon.ReleaseManifestFileName, relName)
+	fmt.Fprintf(&mf, `#
+# List the files to be run, one per line, in the order they should be run.
+# Files are given relative to the release directory. Files in the %[1]s
+# directory are applied with psql; any other file is run as a program and
+# must be executable. Every file in the release directory must be listed
+# in this file or in the %[2]s file.
+#
+# A file name may be followed by attributes of the step:
+#     %-23[3]s do not run the step in the release transaction
+#     %-23[4]s the expected checksum of the file contents
+#     %-23[5]s the longest time the step may run for (eg 5m)
+#
+# These directives apply to the whole release:
+#     %-23[6]s run the release in a single transaction
+#     %-23[7]s the releases which must be applied first
+#
+# This directive runs the steps listed in a shared fragment at that point:
+#     %-23[8]s a fragment in the %[9]s directory
+#
+# The steps between these directives may be run at the same time:
+#     %-23[10]s start a group of steps
+#     %-23[11]s end the group
+#
+# The group attributes say how many steps may run at once and whether, if
+# one fails, the others are cancelled or allowed to finish:
+#     %-23[12]s
+#
+`,
+		dbtcommon.ReleaseSQLDirName,
+		dbtcommon.ReleaseRollbackFileName,
+		dbtcommon.AttrNoTransaction,
+		dbtcommon.AttrSHA256+"=<checksum>",
+		dbtcommon.AttrTimeout+"=<duration>",
+		dbtcommon.DirectiveTransaction,
+		dbtcommon.DirectiveRequires+" <release>...",
+		dbtcommon.DirectiveInclude+" <fragment>",
+		dbtcommon.ReleaseCommonDirName,
+		dbtcommon.DirectiveParallel,
+		dbtcommon.DirectiveEndParallel,
+		dbtcommon.DirectiveParallel+" "+dbtcommon.ParallelAttrMax+"=<n> "+
+			dbtcommon.ParallelAttrOnFailure+"="+dbtcommon.OnFailureCancel+"|"+
+			dbtcommon.OnFailureFinish)
+
+	for _, f := range sqlFiles {
+		mf.WriteString(filepath.Join(dbtcommon.ReleaseSQLDirName, f) + "\n")
+	}
+
+	return mf.String()
+}
+
+// readMeTemplate returns the contents of the ReadMe file for the new
+// release
+func readMeTemplate(relName string, now time.Time) string {
+	return "Release: " + relName + "\n" +
+		"Created: " + now.Format(time.DateOnly) + "\n" +
+		"\n" +
+		"Describe what this release changes and why.\n"
+}
+
+// sqlTemplate returns the contents of an initial SQL file
+func sqlTemplate(relName, fileName string) string {
+	return "-- release: " + relName + "\n" +
+		"-- file:    " + fileName + "\n"
+}
+
+// sqlFileNames returns the names of the initial SQL files with the SQL
+// file suffix added if it is missing. It is an error if the same name is
+// given twice
+func sqlFileNames(names []string) ([]string, error) {
+	files := make([]string, 0, len(names))
+	seen := map[string]bool{}
+
+	for _, n := range names {
+		if !strings.HasSuffix(n, sqlFileSuffix) {
+			n += sqlFileSuffix
+		}
+
+		if seen[n] {
+			return nil, fmt.Errorf("the SQL file %q is given more than once",
+				n)
+		}
+
+		seen[n] = true
+
+		files = append(files, n)
+	}
+
+	return files, nil
+}
+
+// createRelease creates the release directory and its contents. The
+// directory is removed if it cannot be completely created. It returns the
+// names of the files created.
+func (prog *Prog) createRelease(relName string, now time.Time) (
+	[]string, error,
+) {
+	sqlFiles, err := sqlFileNames(prog.sqlFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	relDir := dbtcommon.DbtDirRelease(prog.dbp.BaseDirName, relName)
+
+	// Mkdir, rather than MkdirAll, so that a release created since the
+	// names were checked is not overwritten
+	if err := os.Mkdir(relDir, 0o755); err != nil { //nolint:gosec
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("there is already a release called %q",
+				relName)
+		}
+
+		return nil, err
+	}
+
+	files := map[string]string{
+		dbtcommon.ReleaseManifestFileName: manifestTemplate(relName, sqlFiles),
+		dbtcommon.ReleaseReadMeFileName:   readMeTemplate(relName, now),
+	}
+	names := []string{
+		dbtcommon.ReleaseManifestFileName,
+		dbtcommon.ReleaseReadMeFileName,
+	}
+
+	for _, f := range sqlFiles {
+		name := filepath.Join(dbtcommon.ReleaseSQLDirName, f)
+		files[name] = sqlTemplate(relName, f)
+		names = append(names, name)
+	}
+
+	sqlDir := dbtcommon.DbtDirReleaseSQL(prog.dbp.BaseDirName, relName)
+
+	err = os.Mkdir(sqlDir, 0o755) //nolint:gosec
+	if err != nil {
+		_ = os.RemoveAll(relDir)
+		return nil, err
+	}
+
+	for _, name := range names {
+		err := os.WriteFile(filepath.Join(relDir, name),
+			[]byte(files[name]), 0o644) //nolint:gosec
+		if err != nil {
+			_ = os.RemoveAll(relDir)
+			return nil, err
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nickwells/dbtools/internal/dbtcommon"
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestCreateRelease(t *testing.T) {
+	const relName = "0001-test"
+
+	prog := NewProg()
+	prog.dbp.BaseDirName = t.TempDir()
+	prog.sqlFiles = []string{"02_tables", "01_types.sql"}
+
+	err := os.MkdirAll(dbtcommon.DbtDirReleaseBase(prog.dbp.BaseDirName),
+		0o755) //nolint:gosec
+	if err != nil {
+		t.Fatal("cannot make the release base directory:", err)
+	}
+
+	files, err := prog.createRelease(relName, time.Now())
+	if err != nil {
+		t.Fatal("cannot create the release:", err)
+	}
+
+	testhelper.DiffStringSlice(t, "createRelease", "files", files,
+		[]string{
+			dbtcommon.ReleaseManifestFileName,
+			dbtcommon.ReleaseReadMeFileName,
+			"SQL.files/02_tables.sql",
+			"SQL.files/01_types.sql",
+		})
+
+	mf, rollbackMf, errs := dbtcommon.ParseReleaseManifests(
+		prog.dbp.BaseDirName, relName, false, true)
+	if len(errs) != 0 {
+		t.Errorf("the new release has manifest errors: %v", errs)
+	}
+
+	steps := []string{}
+	for _, s := range mf.Steps {
+		steps = append(steps, s.Name)
+	}
+
+	testhelper.DiffStringSlice(t, "createRelease", "steps", steps,
+		[]string{"SQL.files/02_tables.sql", "SQL.files/01_types.sql"})
+
+	errs = dbtcommon.CheckForUnusedFiles(
+		prog.dbp.BaseDirName, relName, mf, rollbackMf)
+	if len(errs) != 0 {
+		t.Errorf("the new release has unused files: %v", errs)
+	}
+
+	_, err = prog.createRelease(relName, time.Now())
+	testhelper.CheckExpErr(t, err, struct {
+		testhelper.ID
+		testhelper.ExpErr
+	}{
+		ID: testhelper.MkID("repeated release"),
+		ExpErr: testhelper.MkExpErr(
+			`there is already a release called "0001-test"`),
+	})
+}
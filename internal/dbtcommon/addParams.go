@@ -22,6 +22,10 @@ type DBParams struct {
 
 	// DbName is the name of the postgresql database to use
 	DbName string
+
+	// ApprovalRequiredFor matches the names of the databases to which a
+	// release may only be applied if it has an up-to-date approval
+	ApprovalRequiredFor *regexp.Regexp
 }
 
 // NewDBParams returns a pointer to a properly initialised DBParams object
@@ -43,8 +47,24 @@ const (
 	// DbtPsqlPathParamName is the name of the parameter that is used to
 	// override the name of the postgresql command line tool
 	DbtPsqlPathParamName = "psql-path"
+
+	// DbtApprovalParamName is the name of the parameter that is used to set
+	// the databases to which only approved releases may be applied
+	DbtApprovalParamName = "approval-required-for"
 )
 
+// ApprovalRequired returns true if a release must have an up-to-date
+// approval before it can be applied to the database. If no database name
+// has been given then the database cannot be checked against the pattern
+// and so approval is required if any pattern has been given
+func (dbp *DBParams) ApprovalRequired() bool {
+	if dbp.ApprovalRequiredFor == nil {
+		return false
+	}
+
+	return dbp.DbName == "" || dbp.ApprovalRequiredFor.MatchString(dbp.DbName)
+}
+
 // setBaseDirEnvVar sets the value of the environment variable for the
 // Base-directory to the value in the DBParams object
 func setBaseDirEnvVar(dbp *DBParams) param.ActionFunc {
@@ -92,17 +112,37 @@ func AddParams(dbp *DBParams) param.PSetOptFunc {
 			param.GroupName(paramGroupName),
 			param.PostAction(setBaseDirEnvVar(dbp)))
 
+		ps.Add(DbtApprovalParamName,
+			psetter.Regexp{Value: &dbp.ApprovalRequiredFor},
+			"a pattern matching the names of the databases to which a"+
+				" release may only be applied if it has been approved."+
+				" The approval is recorded in the "+
+				ReleaseApprovalFileName+" file in the release directory"+
+				" which names the reviewers and holds the checksums of"+
+				" the "+ReleaseManifestFileName+" file and of every"+
+				" file it lists. A release which has no approval, or"+
+				" which has changed since it was approved, will not be"+
+				" applied. If no database name is given then every"+
+				" release must be approved. This is typically set in"+
+				" the configuration file for this group of parameters",
+			param.AltNames("require-approval"),
+			param.GroupName(paramGroupName))
+
 		return nil
 	}
 }
 
 // AddParamDBName adds the standard db parameter. Not all commands need this
-// and so it is not added in the AddParams function above
+// and so it is not added in the AddParams function above. The parameter
+// must be set unless the opts include a param.Attrs option which overrides
+// this
 func AddParamDBName(
 	dbp *DBParams, ps *param.PSet, opts ...param.ByNameOptFunc,
 ) {
-	opts = append(opts, param.AltNames("db"),
-		param.Attrs(param.MustBeSet))
+	opts = append([]param.ByNameOptFunc{
+		param.AltNames("db"),
+		param.Attrs(param.MustBeSet),
+	}, opts...)
 	ps.Add("db-name",
 		psetter.String[string]{
 			Value: &dbp.DbName,
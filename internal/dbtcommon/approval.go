@@ -0,0 +1,285 @@
+package dbtcommon
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// These are the keys of the entries in the Approval file which records
+// the sign-off of a release. There is a reviewer entry for each reviewer
+// and a file entry, giving the checksum and the name, for each file which
+// was approved
+const (
+	ApprovalTimeFmt     = time.RFC3339
+	ApprovalKeyRel      = "release"
+	ApprovalKeyTime     = "approved"
+	ApprovalKeyReviewer = "reviewer"
+	ApprovalKeyContent  = "content-sha256"
+	ApprovalKeyFile     = "file"
+)
+
+// Approval records the sign-off of a release: who approved it, when, and
+// the checksums of the files they approved
+type Approval struct {
+	Release    string
+	ApprovedAt time.Time
+	Reviewers  []string
+	// ContentSHA256 is the checksum of the release contents, calculated
+	// from the Files
+	ContentSHA256 string
+	// Files maps the names of the approved files, relative to the release
+	// directory, to the checksums of their contents
+	Files map[string]string
+}
+
+// ReleaseContents returns a map of the names of the files which make up
+// the release, relative to the release directory, to the checksums of
+// their contents. These are the given manifest files, the files of every
+// step they contain, the Manifest files of any fragments they include and
+// the Warning file, if there is one. The manifests of any hooks to be run
+// with the release should be given too. Nil manifests are ignored.
+func ReleaseContents(
+	baseDir, relName string, mfs ...*Manifest,
+) (map[string]string, error) {
+	relDir := DbtDirRelease(baseDir, relName)
+	files := map[string]string{}
+
+	add := func(fileName string) error {
+		name, err := filepath.Rel(relDir, fileName)
+		if err != nil {
+			return err
+		}
+
+		sum, err := FileSHA256(fileName)
+		if err != nil {
+			return err
+		}
+
+		files[name] = sum
+
+		return nil
+	}
+
+	for _, mf := range mfs {
+		if mf == nil {
+			continue
+		}
+
+		mfFiles := []*Manifest{mf}
+		mfFiles = append(mfFiles, mf.Fragments...)
+
+		for _, m := range mfFiles {
+			if err := add(m.FileName); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, s := range mf.Steps {
+			if err := add(s.File); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	warnFile := DbtFileReleaseWarning(baseDir, relName)
+	if _, err := os.Stat(warnFile); err == nil {
+		if err := add(warnFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// ContentSHA256 returns a single checksum for the release contents. This
+// is calculated from the names and checksums of the files, in name order
+func ContentSHA256(files map[string]string) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s  %s\n", files[name], name)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewApproval returns an approval of the release contents by the given
+// reviewers at the given time
+func NewApproval(
+	relName string, reviewers []string, files map[string]string, t time.Time,
+) *Approval {
+	return &Approval{
+		Release:       relName,
+		ApprovedAt:    t,
+		Reviewers:     reviewers,
+		ContentSHA256: ContentSHA256(files),
+		Files:         files,
+	}
+}
+
+// AddReviewers adds the reviewers to the approval, ignoring any who have
+// already approved it
+func (a *Approval) AddReviewers(reviewers []string) {
+	for _, r := range reviewers {
+		if !slices.Contains(a.Reviewers, r) {
+			a.Reviewers = append(a.Reviewers, r)
+		}
+	}
+}
+
+// String returns the approval in the format of the Approval file
+func (a *Approval) String() string {
+	var s strings.Builder
+
+	fmt.Fprintf(&s, "%s: %s\n", ApprovalKeyRel, a.Release)
+	fmt.Fprintf(&s, "%s: %s\n",
+		ApprovalKeyTime, a.ApprovedAt.Format(ApprovalTimeFmt))
+
+	for _, r := range a.Reviewers {
+		fmt.Fprintf(&s, "%s: %s\n", ApprovalKeyReviewer, r)
+	}
+
+	fmt.Fprintf(&s, "%s: %s\n", ApprovalKeyContent, a.ContentSHA256)
+
+	names := make([]string, 0, len(a.Files))
+	for name := range a.Files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(&s, "%s: %s %s\n", ApprovalKeyFile, a.Files[name], name)
+	}
+
+	return s.String()
+}
+
+// WriteApproval writes the approval to the Approval file of the release
+func WriteApproval(baseDir string, a *Approval) error {
+	return os.WriteFile(DbtFileReleaseApproval(baseDir, a.Release),
+		[]byte(a.String()), 0o644) //nolint:gosec
+}
+
+// ReadApproval reads the Approval file of the named release. If there is
+// no Approval file a nil approval and a nil error are returned.
+func ReadApproval(baseDir, relName string) (*Approval, error) {
+	fileName := DbtFileReleaseApproval(baseDir, relName)
+
+	f, err := os.Open(fileName) //nolint:gosec
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	a := &Approval{Files: map[string]string{}}
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		k, v, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		v = strings.TrimSpace(v)
+
+		switch strings.TrimSpace(k) {
+		case ApprovalKeyRel:
+			a.Release = v
+		case ApprovalKeyTime:
+			a.ApprovedAt, err = time.Parse(ApprovalTimeFmt, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: bad approval time: %w",
+					fileName, lineNo, err)
+			}
+		case ApprovalKeyReviewer:
+			a.Reviewers = append(a.Reviewers, v)
+		case ApprovalKeyContent:
+			a.ContentSHA256 = v
+		case ApprovalKeyFile:
+			sum, name, ok := strings.Cut(v, " ")
+			if !ok || !SHA256Pattern.MatchString(sum) {
+				return nil, fmt.Errorf("%s:%d: bad file entry: %q",
+					fileName, lineNo, v)
+			}
+
+			a.Files[name] = sum
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Check returns an error if the approval is not for the named release, has
+// no reviewers or does not match the current contents of the release. The
+// error lists any files which have changed, been added or been removed
+// since the release was approved.
+func (a *Approval) Check(relName string, files map[string]string) error {
+	if a.Release != relName {
+		return fmt.Errorf("the %s file is for release %q, not %q",
+			ReleaseApprovalFileName, a.Release, relName)
+	}
+
+	if len(a.Reviewers) == 0 {
+		return fmt.Errorf("the %s file does not name any reviewers",
+			ReleaseApprovalFileName)
+	}
+
+	if a.ContentSHA256 == ContentSHA256(files) &&
+		a.ContentSHA256 == ContentSHA256(a.Files) {
+		return nil
+	}
+
+	var changes []string
+
+	for name, sum := range files {
+		approvedSum, ok := a.Files[name]
+		switch {
+		case !ok:
+			changes = append(changes, "added:   "+name)
+		case approvedSum != sum:
+			changes = append(changes, "changed: "+name)
+		}
+	}
+
+	for name := range a.Files {
+		if _, ok := files[name]; !ok {
+			changes = append(changes, "removed: "+name)
+		}
+	}
+
+	sort.Strings(changes)
+
+	if len(changes) == 0 {
+		return fmt.Errorf("the %s file has been altered: its %s does not"+
+			" match the files it lists",
+			ReleaseApprovalFileName, ApprovalKeyContent)
+	}
+
+	return fmt.Errorf("the release has changed since it was approved on %s"+
+		" by %s:\n\t%s",
+		a.ApprovedAt.Format(time.DateOnly), strings.Join(a.Reviewers, ", "),
+		strings.Join(changes, "\n\t"))
+}
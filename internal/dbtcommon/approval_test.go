@@ -0,0 +1,112 @@
+package dbtcommon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestReadApproval(t *testing.T) {
+	sumA := strings.Repeat("a", 64)
+	sumB := strings.Repeat("b", 64)
+
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		approval     string
+		noFile       bool
+		expNil       bool
+		expRel       string
+		expTime      time.Time
+		expReviewers []string
+		expContent   string
+		expFiles     map[string]string
+	}{
+		{
+			ID:     testhelper.MkID("no Approval file"),
+			noFile: true,
+			expNil: true,
+		},
+		{
+			ID: testhelper.MkID("good"),
+			approval: "release: " + testRelName + "\n" +
+				"approved: 2024-03-01T12:00:00Z\n" +
+				"reviewer: alice\n" +
+				"reviewer: bob\n" +
+				"content-sha256: " + sumA + "\n" +
+				"file: " + sumA + " Manifest\n" +
+				"file: " + sumB + " SQL.files/has space.sql\n",
+			expRel:       testRelName,
+			expTime:      time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			expReviewers: []string{"alice", "bob"},
+			expContent:   sumA,
+			expFiles: map[string]string{
+				"Manifest":                sumA,
+				"SQL.files/has space.sql": sumB,
+			},
+		},
+		{
+			ID: testhelper.MkID("lines without a key are ignored"),
+			approval: "release: " + testRelName + "\n" +
+				"no key here\n" +
+				"\n" +
+				"unknown: value\n",
+			expRel:   testRelName,
+			expFiles: map[string]string{},
+		},
+		{
+			ID:       testhelper.MkID("bad time"),
+			ExpErr:   testhelper.MkExpErr(":2: bad approval time"),
+			approval: "release: " + testRelName + "\napproved: yesterday\n",
+		},
+		{
+			ID:       testhelper.MkID("file entry with no name"),
+			ExpErr:   testhelper.MkExpErr(":1: bad file entry", sumA),
+			approval: "file: " + sumA + "\n",
+		},
+		{
+			ID:       testhelper.MkID("file entry with a bad checksum"),
+			ExpErr:   testhelper.MkExpErr(":1: bad file entry", "xyz Manifest"),
+			approval: "file: xyz Manifest\n",
+		},
+		{
+			ID:       testhelper.MkID("file entry with a short checksum"),
+			ExpErr:   testhelper.MkExpErr(":1: bad file entry"),
+			approval: "file: " + sumA[:63] + " Manifest\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		files := map[string]string{}
+		if !tc.noFile {
+			files[ReleaseApprovalFileName] = tc.approval
+		}
+
+		baseDir := mkTestRelease(t, files)
+
+		a, err := ReadApproval(baseDir, testRelName)
+		if !testhelper.CheckExpErr(t, err, tc) || err != nil {
+			continue
+		}
+
+		if testhelper.DiffBool(t, tc.IDStr(), "nil approval",
+			a == nil, tc.expNil) || a == nil {
+			continue
+		}
+
+		testhelper.DiffString(t, tc.IDStr(), "release", a.Release, tc.expRel)
+		testhelper.DiffTime(t, tc.IDStr(), "approval time",
+			a.ApprovedAt, tc.expTime)
+		testhelper.DiffStringSlice(t, tc.IDStr(), "reviewers",
+			a.Reviewers, tc.expReviewers)
+		testhelper.DiffString(t, tc.IDStr(), "content checksum",
+			a.ContentSHA256, tc.expContent)
+
+		if err := testhelper.DiffVals(a.Files, tc.expFiles); err != nil {
+			t.Log(tc.IDStr())
+			t.Errorf("\t: files: %s", err)
+		}
+	}
+}
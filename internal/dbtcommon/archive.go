@@ -0,0 +1,108 @@
+package dbtcommon
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// These are the keys of the entries in the Applied file which records the
+// details of an archived release
+const (
+	AppliedTimeFmt   = time.RFC3339
+	AppliedKeyRel    = "release"
+	AppliedKeyTime   = "archived"
+	AppliedKeyDB     = "database"
+	AppliedKeyUser   = "user"
+	AppliedKeyHost   = "host"
+	AppliedKeyVsn    = "tool-version"
+	AppliedKeyLedger = "ledger-id"
+)
+
+// ArchivedRelease records the details of a release in the Archive directory
+type ArchivedRelease struct {
+	// DirName is the name of the directory in the Archive directory
+	DirName string
+	// Name is the original name of the release
+	Name string
+	// ArchivedAt is the time when the release was archived. This is taken
+	// from the Applied file or, if that is missing, the modification time
+	// of the directory
+	ArchivedAt time.Time
+}
+
+// readAppliedFile reads the Applied file from the archived release
+// directory and returns the key/value pairs it contains
+func readAppliedFile(dir string) (map[string]string, error) {
+	f, err := os.Open( //nolint:gosec
+		filepath.Join(dir, ReleaseAppliedFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	meta := map[string]string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), ":")
+		if ok {
+			meta[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+
+	return meta, scanner.Err()
+}
+
+// FindArchivedReleases finds all the releases in the Archive directory. A
+// missing Archive directory is not an error, there are simply no archived
+// releases.
+func FindArchivedReleases(baseDir string) ([]ArchivedRelease, error) {
+	archiveDir := DbtDirReleaseArchive(baseDir)
+
+	entries, err := os.ReadDir(archiveDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	archived := make([]ArchivedRelease, 0, len(entries))
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		ar := ArchivedRelease{DirName: entry.Name(), Name: entry.Name()}
+
+		if info, err := entry.Info(); err == nil {
+			ar.ArchivedAt = info.ModTime()
+		}
+
+		meta, err := readAppliedFile(filepath.Join(archiveDir, entry.Name()))
+		if err == nil {
+			if n := meta[AppliedKeyRel]; n != "" {
+				ar.Name = n
+			}
+
+			t, err := time.Parse(AppliedTimeFmt, meta[AppliedKeyTime])
+			if err == nil {
+				ar.ArchivedAt = t
+			}
+		}
+
+		archived = append(archived, ar)
+	}
+
+	sort.Slice(archived, func(i, j int) bool {
+		return archived[i].DirName < archived[j].DirName
+	})
+
+	return archived, nil
+}
@@ -0,0 +1,32 @@
+package dbtcommon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// FileSHA256 returns the SHA-256 checksum of the contents of the named file
+// as a hex string
+func FileSHA256(fileName string) (string, error) {
+	f, err := os.Open(fileName) //nolint:gosec
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// BytesSHA256 returns the SHA-256 checksum of the data as a hex string
+func BytesSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
@@ -19,12 +19,20 @@ type DirSpec struct {
 const (
 	DbtDirName = "db.postgres"
 
-	ReleaseScriptsBaseName  = "releaseScripts"
-	ReleaseArchiveDirName   = "Archive"
-	ReleaseSQLDirName       = "SQL.files"
-	ReleaseManifestFileName = "Manifest"
-	ReleaseReadMeFileName   = "ReadMe"
-	ReleaseWarningFileName  = "Warning"
+	ReleaseScriptsBaseName   = "releaseScripts"
+	ReleaseArchiveDirName    = "Archive"
+	ReleaseCommonDirName     = "Common"
+	ReleaseHooksDirName      = "Hooks"
+	ReleaseSQLDirName        = "SQL.files"
+	ReleaseManifestFileName  = "Manifest"
+	ReleaseRollbackFileName  = "Rollback"
+	ReleaseReadMeFileName    = "ReadMe"
+	ReleaseWarningFileName   = "Warning"
+	ReleaseAppliedFileName   = "Applied"
+	ReleaseApprovalFileName  = "Approval"
+	ReleaseTranscriptDirName = "Transcripts"
+	ReleaseLockFileName      = ".dbtools.lock"
+	ExpandedSQLFilePrefix    = ".dbtools.expanded."
 
 	MacrosDirName   = "macros"
 	DBSchemaDirName = "db.schema"
@@ -105,6 +113,37 @@ func DbtDirReleaseBase(basename string) string {
 	return filepath.Join(DbtDirStart(basename), ReleaseScriptsBaseName)
 }
 
+// DbtDirReleaseArchive returns the full name of the release archive
+// directory
+func DbtDirReleaseArchive(basename string) string {
+	return filepath.Join(DbtDirReleaseBase(basename), ReleaseArchiveDirName)
+}
+
+// DbtDirReleaseCommon returns the full name of the directory holding the
+// Manifest fragments which may be included by any release
+func DbtDirReleaseCommon(basename string) string {
+	return filepath.Join(DbtDirReleaseBase(basename), ReleaseCommonDirName)
+}
+
+// DbtDirReleaseFragment returns the full name of the directory holding the
+// named Manifest fragment
+func DbtDirReleaseFragment(basename, fragment string) string {
+	return filepath.Join(DbtDirReleaseCommon(basename), fragment)
+}
+
+// DbtDirReleaseHooks returns the full name of the directory holding the
+// hooks which are run before and after every release
+func DbtDirReleaseHooks(basename string) string {
+	return filepath.Join(DbtDirReleaseBase(basename), ReleaseHooksDirName)
+}
+
+// DbtDirReleaseHooksDB returns the full name of the directory holding the
+// hooks which are run before and after every release applied to the named
+// database. These replace the hooks for all databases
+func DbtDirReleaseHooksDB(basename, dbName string) string {
+	return filepath.Join(DbtDirReleaseHooks(basename), dbName)
+}
+
 // DbtDirRelease returns the full name of the release directory
 func DbtDirRelease(basename, rel string) string {
 	return filepath.Join(DbtDirReleaseBase(basename), rel)
@@ -120,6 +159,12 @@ func DbtFileReleaseManifest(basename, rel string) string {
 	return filepath.Join(DbtDirRelease(basename, rel), ReleaseManifestFileName)
 }
 
+// DbtFileReleaseRollback returns the full name of the release rollback
+// manifest file
+func DbtFileReleaseRollback(basename, rel string) string {
+	return filepath.Join(DbtDirRelease(basename, rel), ReleaseRollbackFileName)
+}
+
 // DbtFileReleaseReadMe returns the full name of the release ReadMe file
 func DbtFileReleaseReadMe(basename, rel string) string {
 	return filepath.Join(DbtDirRelease(basename, rel), ReleaseReadMeFileName)
@@ -130,6 +175,23 @@ func DbtFileReleaseWarning(basename, rel string) string {
 	return filepath.Join(DbtDirRelease(basename, rel), ReleaseWarningFileName)
 }
 
+// DbtFileReleaseApproval returns the full name of the release Approval file
+func DbtFileReleaseApproval(basename, rel string) string {
+	return filepath.Join(DbtDirRelease(basename, rel),
+		ReleaseApprovalFileName)
+}
+
+// DbtFileReleaseLock returns the full name of the file which is locked
+// while releases are being applied to the named database
+func DbtFileReleaseLock(basename, dbName string) string {
+	name := ReleaseLockFileName
+	if dbName != "" {
+		name += "." + dbName
+	}
+
+	return filepath.Join(DbtDirReleaseBase(basename), name)
+}
+
 // checkSubDirs recursively checks the dirs exist in base
 func checkSubDirs(base string, dirs []DirSpec) bool {
 	for _, d := range dirs {
@@ -0,0 +1,172 @@
+package dbtcommon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// These are the names of the hook files. Each lists steps, in the same
+// format as a Manifest file, which are run before the first step or after
+// the last step of every release
+const (
+	HookPreRelease  = "PreRelease"
+	HookPostRelease = "PostRelease"
+)
+
+// HookFileNames holds the names of the hook files in the order they are
+// run
+var HookFileNames = []string{HookPreRelease, HookPostRelease}
+
+// FindHookFile returns the full name of the named hook file to be used for
+// releases applied to the database. A hook file in the hooks directory for
+// the database replaces the one for all databases. An empty string is
+// returned if there is no hook file.
+func FindHookFile(baseDir, dbName, hook string) string {
+	dirs := []string{DbtDirReleaseHooks(baseDir)}
+	if dbName != "" {
+		dirs = append([]string{DbtDirReleaseHooksDB(baseDir, dbName)}, dirs...)
+	}
+
+	for _, dir := range dirs {
+		fileName := filepath.Join(dir, hook)
+		if _, err := os.Stat(fileName); err == nil {
+			return fileName
+		}
+	}
+
+	return ""
+}
+
+// ParseHookFile reads the hook file and records the steps in the order
+// they appear. The files are given relative to the directory holding the
+// hook file and are checked as for a Manifest file. Only the include
+// directive may be given. An empty hook file is not an error; it can be
+// used to replace the hooks for all databases with no hooks.
+func ParseHookFile(baseDir, fileName string, checkSums bool) (
+	*Manifest, []error,
+) {
+	mf := NewManifest(fileName)
+	hook := filepath.Base(fileName)
+	dir := filepath.Dir(fileName)
+
+	fStat, err := os.Stat(fileName)
+	if err != nil {
+		return mf, []error{err}
+	}
+
+	if !fStat.Mode().IsRegular() {
+		return mf, []error{
+			fmt.Errorf("the hook file (%s) is not a regular file", fileName),
+		}
+	}
+
+	mfp := manifestFileParser{
+		root:       mf,
+		mf:         mf,
+		baseDir:    baseDir,
+		releaseDir: dir,
+		dir:        dir,
+		sqlDir:     filepath.Join(dir, ReleaseSQLDirName),
+		checkSums:  checkSums,
+		hook:       hook,
+	}
+
+	srcName, err := filepath.Rel(DbtDirReleaseBase(baseDir), fileName)
+	if err != nil {
+		srcName = hook
+	}
+
+	fp := NewManifestFileParser(srcName, &mfp)
+
+	return mf, fp.Parse(fileName)
+}
+
+// isHookDir returns true if the directory holds any hook files
+func isHookDir(dir string) bool {
+	for _, hook := range HookFileNames {
+		if _, err := os.Stat(filepath.Join(dir, hook)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckForUnusedHookFiles checks that all the files in the hooks directory
+// for all databases and, if a database is named, in the hooks directory
+// for that database, are used by the hook files in the same directory. The
+// sub-directories of the hooks directory which hold the hooks of a
+// database are not checked as part of it. A directory whose hook files
+// cannot be parsed is not checked; the errors are reported when the hooks
+// are used.
+func CheckForUnusedHookFiles(baseDir, dbName string) []error {
+	dirs := []string{DbtDirReleaseHooks(baseDir)}
+	if dbName != "" {
+		dirs = append(dirs, DbtDirReleaseHooksDB(baseDir, dbName))
+	}
+
+	var errs []error
+
+	for _, dir := range dirs {
+		errs = append(errs, unusedHookFiles(baseDir, dir)...)
+	}
+
+	return errs
+}
+
+// unusedHookFiles checks that all the files in the hooks directory are
+// used by the hook files in it. Any sub-directory holding hook files is
+// the hooks directory of a database and is not checked.
+func unusedHookFiles(baseDir, dir string) []error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return []error{err}
+	}
+
+	ignoreEntry := map[string]bool{}
+
+	for _, e := range entries {
+		if e.IsDir() && isHookDir(filepath.Join(dir, e.Name())) {
+			ignoreEntry[e.Name()] = true
+		}
+	}
+
+	var mfs []*Manifest
+
+	for _, hook := range HookFileNames {
+		fileName := filepath.Join(dir, hook)
+		if _, err := os.Stat(fileName); err != nil {
+			continue
+		}
+
+		ignoreEntry[hook] = true
+
+		mf, errs := ParseHookFile(baseDir, fileName, false)
+		if len(errs) > 0 {
+			return nil
+		}
+
+		mfs = append(mfs, mf)
+	}
+
+	return unusedFiles(dir, ignoreEntry,
+		func(name string) bool {
+			for _, mf := range mfs {
+				if mf.HasFile(name) {
+					return true
+				}
+			}
+
+			return false
+		},
+		func(name string) error {
+			return fmt.Errorf("the hooks directory (%s) contains %q"+
+				" which is not in any of its hook files",
+				dir, name)
+		})
+}
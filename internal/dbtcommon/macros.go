@@ -0,0 +1,45 @@
+package dbtcommon
+
+import (
+	"slices"
+
+	"github.com/nickwells/check.mod/v2/check"
+	"github.com/nickwells/macros.mod/macros"
+	"github.com/nickwells/param.mod/v7/param"
+	"github.com/nickwells/param.mod/v7/psetter"
+)
+
+// MacroFileSuffix is the suffix which is tried when looking for the file
+// holding a macro
+const MacroFileSuffix = ".sql"
+
+// MacroDirsParamName is the name of the parameter giving any additional
+// macro directories
+const MacroDirsParamName = "macro-dirs"
+
+// AddParamMacroDirs adds the standard macro-dirs parameter. Not all
+// commands need this and so it is not added in the AddParams function
+// above
+func AddParamMacroDirs(
+	dirs *[]string, ps *param.PSet, opts ...param.ByNameOptFunc,
+) {
+	ps.Add(MacroDirsParamName,
+		psetter.StrList[string]{
+			Value: dirs,
+			Checks: []check.ValCk[[]string]{
+				check.SliceLength[[]string](check.ValGT(0)),
+				check.SliceHasNoDups[[]string, string],
+			},
+		},
+		"a list of additional directories in which macros may be found",
+		opts...)
+}
+
+// NewMacroCache constructs a macro cache which will search the given
+// directories and then the default macro directory for macros
+func NewMacroCache(dbp *DBParams, dirs []string) (*macros.Cache, error) {
+	return macros.NewCache(
+		macros.Dirs(slices.Concat(dirs,
+			[]string{DbtDirMacros(dbp.BaseDirName)})...),
+		macros.Suffix(MacroFileSuffix))
+}
@@ -0,0 +1,553 @@
+package dbtcommon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nickwells/fileparse.mod/fileparse"
+	"github.com/nickwells/location.mod/location"
+)
+
+// These are the directives which may appear in the manifest file
+const (
+	DirectivePrefix      = "@"
+	DirectiveTransaction = DirectivePrefix + "transaction"
+	DirectiveRequires    = DirectivePrefix + "requires"
+	DirectiveInclude     = DirectivePrefix + "include"
+	DirectiveParallel    = DirectivePrefix + "parallel"
+	DirectiveEndParallel = DirectivePrefix + "end-parallel"
+)
+
+// ManifestCommentIntro starts a comment in a manifest file. The comment
+// runs to the end of the line
+const ManifestCommentIntro = "#"
+
+// NewManifestFileParser returns a file parser which will give the lines of
+// a manifest file, with any comments removed, to the line parser. The
+// source name is used in the location of each line
+func NewManifestFileParser(
+	srcName string, lp fileparse.LineParser,
+) *fileparse.FP {
+	fp := fileparse.New(srcName, lp)
+	fp.SetCommentIntro(ManifestCommentIntro)
+	fp.SetInclKeyWord("")
+
+	return fp
+}
+
+// Manifest holds the contents of a manifest file
+type Manifest struct {
+	// FileName is the full pathname of the manifest file
+	FileName string
+	// FileMap maps the names of the files in the manifest to the place
+	// where they are given
+	FileMap map[string]location.L
+	// Steps holds the steps in the order they are given
+	Steps []*Step
+	// InTransaction is set if the manifest requests that the release
+	// should be run in a single transaction
+	InTransaction bool
+	// Requires holds the names of the releases which must have been
+	// applied before this release can be applied
+	Requires []string
+	// Fragments holds the Manifest fragments included by the manifest, and
+	// by any fragments it includes, in the order they are included. The
+	// steps of a fragment are added to the manifest which includes it; the
+	// FileMap of a fragment gives its files relative to the fragment
+	// directory
+	Fragments []*Manifest
+	// Groups holds the groups of steps which may be run concurrently, in
+	// the order they are given
+	Groups []*ParallelGroup
+}
+
+// NewManifest returns a new, empty manifest for the given file
+func NewManifest(fileName string) *Manifest {
+	return &Manifest{
+		FileName: fileName,
+		FileMap:  map[string]location.L{},
+	}
+}
+
+// HasFile returns true if the named file is given in the manifest. It is
+// safe to call on a nil manifest.
+func (mf *Manifest) HasFile(name string) bool {
+	if mf == nil {
+		return false
+	}
+
+	_, ok := mf.FileMap[name]
+
+	return ok
+}
+
+type manifestFileParser struct {
+	// root is the release manifest to which the steps are added
+	root *Manifest
+	// mf is the manifest being parsed, either the release manifest or a
+	// fragment which it includes
+	mf         *Manifest
+	baseDir    string
+	releaseDir string
+	// dir is the directory which the files in the manifest are relative to
+	dir       string
+	sqlDir    string
+	checkSums bool
+	// fragment is the name of the fragment being parsed. It is empty if the
+	// release manifest is being parsed
+	fragment string
+	// group is the parallel group currently being parsed. It is nil if
+	// the steps are not in a parallel group
+	group *ParallelGroup
+	// hook is the name of the hook file being parsed. It is empty unless
+	// a hook file is being parsed
+	hook string
+}
+
+// dirDesc returns a description of the directory which the files in the
+// manifest are relative to
+func (mfp *manifestFileParser) dirDesc() string {
+	if mfp.fragment != "" {
+		return "fragment directory (" + mfp.dir + ")"
+	}
+
+	if mfp.hook != "" {
+		return "hooks directory (" + mfp.dir + ")"
+	}
+
+	return "release directory (" + mfp.dir + ")"
+}
+
+// (mfp *manifestFileParser) parseDirective parses a directive line from the
+// manifest file
+func (mfp *manifestFileParser) parseDirective(
+	line string, loc *location.L,
+) error {
+	parts := strings.Fields(line)
+
+	if mfp.fragment != "" && parts[0] != DirectiveInclude {
+		return loc.Errorf("The %s directive cannot be given in a fragment",
+			parts[0])
+	}
+
+	if mfp.hook != "" && parts[0] != DirectiveInclude {
+		return loc.Errorf("The %s directive cannot be given in a %s file",
+			parts[0], mfp.hook)
+	}
+
+	switch parts[0] {
+	case DirectiveTransaction:
+		if len(parts) != 1 {
+			return loc.Errorf("The %s directive takes no arguments",
+				DirectiveTransaction)
+		}
+
+		mfp.mf.InTransaction = true
+	case DirectiveRequires:
+		if filepath.Base(mfp.mf.FileName) != ReleaseManifestFileName {
+			return loc.Errorf("The %s directive may only be given in the %s"+
+				" file", DirectiveRequires, ReleaseManifestFileName)
+		}
+
+		reqs, err := parseRequires(parts[1:],
+			filepath.Base(mfp.releaseDir), mfp.mf.Requires, loc)
+		if err != nil {
+			return err
+		}
+
+		mfp.mf.Requires = append(mfp.mf.Requires, reqs...)
+	case DirectiveInclude:
+		if mfp.group != nil {
+			return loc.Errorf("The %s directive cannot be given in a"+
+				" parallel group (started at: %s)",
+				DirectiveInclude, mfp.group.Loc)
+		}
+
+		return mfp.include(parts[1:], loc)
+	case DirectiveParallel:
+		if mfp.group != nil {
+			return loc.Errorf("Parallel groups cannot be nested."+
+				" The group started at: %s has not been ended with %s",
+				mfp.group.Loc, DirectiveEndParallel)
+		}
+
+		g, err := newParallelGroup(parts[1:], loc)
+		if err != nil {
+			return err
+		}
+
+		mfp.group = g
+	case DirectiveEndParallel:
+		return mfp.endGroup(parts, loc)
+	default:
+		return loc.Errorf("Unknown directive: %q", parts[0])
+	}
+
+	return nil
+}
+
+// endGroup ends the parallel group currently being parsed and records it
+// in the manifest. It is an error if there is no group or it is empty
+func (mfp *manifestFileParser) endGroup(parts []string, loc *location.L) error {
+	if len(parts) != 1 {
+		return loc.Errorf("The %s directive takes no arguments",
+			DirectiveEndParallel)
+	}
+
+	if mfp.group == nil {
+		return loc.Errorf("The %s directive is not in a parallel group",
+			DirectiveEndParallel)
+	}
+
+	g := mfp.group
+	mfp.group = nil
+
+	if len(g.Steps) == 0 {
+		return loc.Errorf("The parallel group (started at: %s) is empty",
+			g.Loc)
+	}
+
+	mfp.mf.Groups = append(mfp.mf.Groups, g)
+
+	return nil
+}
+
+// include parses the Manifest file of the named fragment. The steps it
+// gives are added to the release manifest at this point. A fragment may
+// only be included once.
+func (mfp *manifestFileParser) include(args []string, loc *location.L) error {
+	if len(args) != 1 {
+		return loc.Errorf("The %s directive must be given the name of"+
+			" one fragment", DirectiveInclude)
+	}
+
+	name := args[0]
+	if !filepath.IsLocal(name) ||
+		strings.ContainsRune(name, filepath.Separator) {
+		return loc.Errorf("%q is not a valid fragment name", name)
+	}
+
+	fragDir := DbtDirReleaseFragment(mfp.baseDir, name)
+	frag := NewManifest(filepath.Join(fragDir, ReleaseManifestFileName))
+
+	for _, f := range mfp.root.Fragments {
+		if f.FileName == frag.FileName {
+			return loc.Errorf("The fragment %q has already been included",
+				name)
+		}
+	}
+
+	if _, err := os.Stat(frag.FileName); err != nil {
+		if os.IsNotExist(err) {
+			return loc.Errorf("There is no fragment called %q:"+
+				" %s does not exist", name, frag.FileName)
+		}
+
+		return loc.Error(err.Error())
+	}
+
+	mfp.root.Fragments = append(mfp.root.Fragments, frag)
+
+	fragMfp := manifestFileParser{
+		root:       mfp.root,
+		mf:         frag,
+		baseDir:    mfp.baseDir,
+		releaseDir: mfp.releaseDir,
+		dir:        fragDir,
+		sqlDir:     filepath.Join(fragDir, ReleaseSQLDirName),
+		checkSums:  mfp.checkSums,
+		fragment:   name,
+	}
+
+	fp := NewManifestFileParser(
+		filepath.Join(ReleaseCommonDirName, name, ReleaseManifestFileName),
+		&fragMfp)
+
+	errs := fp.Parse(frag.FileName)
+	if len(errs) == 0 && len(frag.FileMap) == 0 {
+		errs = append(errs, fmt.Errorf("the fragment %s file is empty",
+			ReleaseManifestFileName))
+	}
+
+	if len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs,
+				"\t"+strings.ReplaceAll(err.Error(), "\n", "\n\t"))
+		}
+
+		return loc.Errorf("The fragment %q cannot be included:\n%s",
+			name, strings.Join(msgs, "\n"))
+	}
+
+	return nil
+}
+
+// (mfp *manifestFileParser) ParseLine parses a line from the manifest file
+func (mfp *manifestFileParser) ParseLine(line string, loc *location.L) error {
+	if strings.HasPrefix(line, DirectivePrefix) {
+		return mfp.parseDirective(line, loc)
+	}
+
+	parts := strings.Fields(line)
+
+	if filepath.IsAbs(parts[0]) {
+		return loc.Errorf("%q is an absolute pathname."+
+			" Files must be given relative to the %s",
+			parts[0], mfp.dirDesc())
+	}
+
+	if !filepath.IsLocal(parts[0]) {
+		return loc.Errorf("%q is not within the %s",
+			parts[0], mfp.dirDesc())
+	}
+
+	localName := filepath.Clean(parts[0])
+	file := filepath.Join(mfp.dir, localName)
+
+	fStat, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return loc.Errorf("The %s does not contain %q",
+				mfp.dirDesc(), parts[0])
+		}
+
+		return loc.Error(err.Error())
+	}
+
+	if !fStat.Mode().IsRegular() {
+		return loc.Errorf("The %s contains %q but it is not a regular file",
+			mfp.dirDesc(), parts[0])
+	}
+
+	// steps are always named relative to the release directory so that
+	// the steps from a fragment can be told apart from those of the
+	// release and a file cannot be given twice
+	name := localName
+	if mfp.fragment != "" {
+		name, err = filepath.Rel(mfp.releaseDir, file)
+		if err != nil {
+			return loc.Error(err.Error())
+		}
+	}
+
+	if prevLoc, ok := mfp.root.FileMap[name]; ok {
+		return loc.Errorf("The file is already in the manifest at: %s",
+			prevLoc)
+	}
+
+	s := &Step{
+		Name:  name,
+		File:  file,
+		IsSQL: strings.HasPrefix(file, mfp.sqlDir+string(filepath.Separator)),
+		Loc:   *loc,
+	}
+
+	if err := s.setAttrs(parts[1:], loc); err != nil {
+		return err
+	}
+
+	if mfp.checkSums {
+		if err := s.CheckSum(); err != nil {
+			return err
+		}
+	}
+
+	mfp.mf.FileMap[localName] = *loc
+	mfp.root.FileMap[name] = *loc
+	mfp.root.Steps = append(mfp.root.Steps, s)
+
+	if mfp.group != nil {
+		s.Group = mfp.group
+		mfp.group.Steps = append(mfp.group.Steps, s)
+	}
+
+	return nil
+}
+
+// CheckTransactionSteps checks that every step can take part in a single
+// release transaction or is marked as not to be run in the transaction.
+// Executable steps cannot take part in the transaction as they are run as
+// separate programs and the steps in a parallel group cannot as they are
+// run in separate sessions.
+func (mf *Manifest) CheckTransactionSteps() []error {
+	var errs []error
+
+	for _, s := range mf.Steps {
+		if s.Group != nil && s.InTx() {
+			errs = append(errs,
+				s.Loc.Errorf("%q is in a parallel group (started at: %s)"+
+					" and so cannot take part in the release transaction."+
+					" Either mark it with the %q attribute or do not run"+
+					" the release in a single transaction",
+					s.Name, s.Group.Loc, AttrNoTransaction))
+
+			continue
+		}
+
+		if !s.IsSQL && !s.NoTransaction {
+			errs = append(errs,
+				s.Loc.Errorf("%q is an executable step which cannot take"+
+					" part in the release transaction. Either mark it"+
+					" with the %q attribute or do not run the release"+
+					" in a single transaction",
+					s.Name, AttrNoTransaction))
+		}
+	}
+
+	return errs
+}
+
+// ParseManifestFile reads the manifest file of the named release and
+// records the steps in the order they appear in the manifest file. The
+// files are checked to make sure they exist and an error is generated if
+// they don't. A duplicate entry is also an error. If checkSums is true any
+// checksums given in the manifest are checked against the file contents.
+//
+// Each line gives a file name optionally followed by attributes of the
+// step. Lines starting with the directive prefix (@) apply to the release
+// as a whole, except for those which start and end a group of steps that
+// may be run concurrently.
+func ParseManifestFile(
+	mf *Manifest, baseDir, relName, desc string, checkSums bool,
+) []error {
+	relDir := DbtDirRelease(baseDir, relName)
+	mfName := filepath.Base(mf.FileName)
+
+	var errors []error
+
+	mfStat, err := os.Stat(mf.FileName)
+	if err != nil {
+		errors = append(errors, err)
+		if os.IsNotExist(err) {
+			errors = append(errors,
+				fmt.Errorf(
+					"the release directory (%s) does not contain a"+
+						" file called %q. This lists the %s"+
+						" files to apply and the order in which they"+
+						" should be applied",
+					relDir, mfName, desc))
+		}
+
+		return errors
+	}
+
+	if !mfStat.Mode().IsRegular() {
+		errors = append(errors,
+			fmt.Errorf(
+				"the release directory (%s) contains %q but it is"+
+					" not a regular file",
+				relDir, mfName))
+
+		return errors
+	}
+
+	mfp := manifestFileParser{
+		root:       mf,
+		mf:         mf,
+		baseDir:    baseDir,
+		releaseDir: relDir,
+		dir:        relDir,
+		sqlDir:     DbtDirReleaseSQL(baseDir, relName),
+		checkSums:  checkSums,
+	}
+
+	fp := NewManifestFileParser(mfName, &mfp)
+	errors = append(errors, fp.Parse(mf.FileName)...)
+
+	if mfp.group != nil {
+		errors = append(errors,
+			mfp.group.Loc.Errorf("The parallel group is not ended with %s",
+				DirectiveEndParallel))
+	}
+
+	if len(mf.Steps) == 0 {
+		errors = append(errors,
+			fmt.Errorf(
+				"the %s is empty - all the lines are empty or comments",
+				mfName))
+	}
+
+	return errors
+}
+
+// parseRequires checks the names of the releases given in a requires
+// directive and returns them. A release cannot require itself and the
+// names must not have been given before.
+func parseRequires(
+	names []string, relName string, prev []string, loc *location.L,
+) ([]string, error) {
+	if len(names) == 0 {
+		return nil, loc.Errorf("The %s directive must be given the names"+
+			" of the releases which are required", DirectiveRequires)
+	}
+
+	reqs := make([]string, 0, len(names))
+
+	for _, name := range names {
+		if !filepath.IsLocal(name) ||
+			strings.ContainsRune(name, filepath.Separator) ||
+			IsReservedDirName(name) {
+			return nil, loc.Errorf("%q is not a valid release name", name)
+		}
+
+		if name == relName {
+			return nil, loc.Errorf("A release cannot require itself")
+		}
+
+		if slices.Contains(prev, name) || slices.Contains(reqs, name) {
+			return nil, loc.Errorf("The release %q is already required",
+				name)
+		}
+
+		reqs = append(reqs, name)
+	}
+
+	return reqs, nil
+}
+
+// requiresParser reads just the requires directives from a manifest file
+type requiresParser struct {
+	relName  string
+	requires []string
+}
+
+// (rp *requiresParser) ParseLine parses a line from the manifest file,
+// ignoring anything other than a requires directive
+func (rp *requiresParser) ParseLine(line string, loc *location.L) error {
+	parts := strings.Fields(line)
+	if parts[0] != DirectiveRequires {
+		return nil
+	}
+
+	reqs, err := parseRequires(parts[1:], rp.relName, rp.requires, loc)
+	if err != nil {
+		return err
+	}
+
+	rp.requires = append(rp.requires, reqs...)
+
+	return nil
+}
+
+// ReadRequires returns the names of the releases required by the release
+// whose manifest file is given. A missing manifest file is not an error,
+// the release simply has no requirements.
+func ReadRequires(mfName, relName string) ([]string, []error) {
+	if _, err := os.Stat(mfName); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	rp := requiresParser{relName: relName}
+
+	fp := NewManifestFileParser(ReleaseManifestFileName, &rp)
+
+	if errs := fp.Parse(mfName); len(errs) > 0 {
+		return nil, errs
+	}
+
+	return rp.requires, nil
+}
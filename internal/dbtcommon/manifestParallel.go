@@ -0,0 +1,72 @@
+package dbtcommon
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/nickwells/location.mod/location"
+)
+
+// These are the attributes that may follow the parallel directive
+const (
+	ParallelAttrMax       = "max"
+	ParallelAttrOnFailure = "on-failure"
+)
+
+// These are the values of the on-failure attribute of a parallel group. They
+// say what happens to the other members of the group when one fails
+const (
+	OnFailureCancel = "cancel"
+	OnFailureFinish = "finish"
+)
+
+// ParallelGroup holds the details of a group of consecutive manifest steps
+// which may be run concurrently
+type ParallelGroup struct {
+	// Max is the greatest number of steps in the group which may run at the
+	// same time, zero means that the default limit applies
+	Max int
+	// OnFailure says what should happen to the other steps in the group if
+	// one of them fails: they are either cancelled or allowed to finish
+	OnFailure string
+	// Steps holds the steps in the group in the order they are given
+	Steps []*Step
+	// Loc records where the group is started in the manifest
+	Loc location.L
+}
+
+// newParallelGroup returns a new parallel group with the attributes set
+// from the values given after the parallel directive
+func newParallelGroup(attrs []string, loc *location.L) (*ParallelGroup, error) {
+	g := &ParallelGroup{
+		OnFailure: OnFailureCancel,
+		Loc:       *loc,
+	}
+
+	for _, a := range attrs {
+		key, val, _ := strings.Cut(a, "=")
+
+		switch key {
+		case ParallelAttrMax:
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return nil, loc.Errorf("The %q attribute must be given"+
+					" a whole number greater than zero", key)
+			}
+
+			g.Max = n
+		case ParallelAttrOnFailure:
+			if val != OnFailureCancel && val != OnFailureFinish {
+				return nil, loc.Errorf("The %q attribute must be given"+
+					" either %q or %q", key, OnFailureCancel, OnFailureFinish)
+			}
+
+			g.OnFailure = val
+		default:
+			return nil, loc.Errorf("Unknown %s attribute: %q",
+				DirectiveParallel, a)
+		}
+	}
+
+	return g, nil
+}
@@ -0,0 +1,134 @@
+package dbtcommon
+
+import (
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nickwells/location.mod/location"
+)
+
+// These are the types of manifest step
+const (
+	StepTypeSQL  = "SQL"
+	StepTypeExec = "executable"
+)
+
+// Step holds the details of a single entry in a release manifest
+type Step struct {
+	// Name is the name of the file relative to the release directory
+	Name string
+	// File is the full pathname of the file
+	File string
+	// IsSQL is true if the file is in the release SQL directory
+	IsSQL bool
+	// NoTransaction is true if the step cannot be run inside a transaction
+	NoTransaction bool
+	// SHA256 is the expected checksum of the file contents, if given
+	SHA256 string
+	// Timeout is the longest time the step may run for, zero means that
+	// there is no limit. It is only used if TimeoutSet is true, otherwise
+	// the default timeout applies
+	Timeout    time.Duration
+	TimeoutSet bool
+	// Loc records where the step is given in the manifest
+	Loc location.L
+	// Group is the parallel group which the step is in, if any
+	Group *ParallelGroup
+}
+
+// StepType returns a description of the type of the step
+func (s Step) StepType() string {
+	if s.IsSQL {
+		return StepTypeSQL
+	}
+
+	return StepTypeExec
+}
+
+// Command returns the command which will run the step. SQL files are
+// applied with the standard SQL command, anything else is run directly
+func (s Step) Command(dbp *DBParams) *exec.Cmd {
+	if s.IsSQL {
+		return SQLCommand(dbp, s.File)
+	}
+
+	return exec.Command(s.File) //nolint:gosec
+}
+
+// These are the attributes that may follow the file name in the manifest
+const (
+	AttrNoTransaction = "no-transaction"
+	AttrSHA256        = "sha256"
+	AttrTimeout       = "timeout"
+)
+
+// SHA256Pattern matches a valid SHA-256 checksum as a hex string
+var SHA256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// setAttrs sets the attributes of the step from the values given after the
+// file name in the manifest
+func (s *Step) setAttrs(attrs []string, loc *location.L) error {
+	for _, a := range attrs {
+		key, val, hasVal := strings.Cut(a, "=")
+
+		switch key {
+		case AttrNoTransaction:
+			if hasVal {
+				return loc.Errorf("The %q attribute takes no value", key)
+			}
+
+			s.NoTransaction = true
+		case AttrSHA256:
+			if !SHA256Pattern.MatchString(val) {
+				return loc.Errorf("The %q attribute must be given"+
+					" a SHA-256 checksum (64 lowercase hex digits)", key)
+			}
+
+			s.SHA256 = val
+		case AttrTimeout:
+			d, err := time.ParseDuration(val)
+			if err != nil || d < 0 {
+				return loc.Errorf("The %q attribute must be given"+
+					" a non-negative duration (such as 90s or 5m)", key)
+			}
+
+			s.Timeout = d
+			s.TimeoutSet = true
+		default:
+			return loc.Errorf("Unknown step attribute: %q", a)
+		}
+	}
+
+	return nil
+}
+
+// InTx returns true if the step should be run as part of the release
+// transaction when the release is run in transactional mode
+func (s Step) InTx() bool {
+	return s.IsSQL && !s.NoTransaction
+}
+
+// CheckSum returns an error if the step has an expected checksum and the
+// contents of the file no longer match it
+func (s Step) CheckSum() error {
+	if s.SHA256 == "" {
+		return nil
+	}
+
+	sum, err := FileSHA256(s.File)
+	if err != nil {
+		return s.Loc.Errorf("Cannot calculate the checksum of %q: %s",
+			s.Name, err)
+	}
+
+	if sum != s.SHA256 {
+		return s.Loc.Errorf("The contents of %q have changed:"+
+			" the checksum does not match the one in the %s file",
+			s.Name, filepath.Base(s.Loc.Source()))
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package dbtcommon
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+func TestParseManifestFile(t *testing.T) {
+	stepFiles := map[string]string{
+		"a.sh":                    "#!/bin/sh\n",
+		"b.sh":                    "#!/bin/sh\n",
+		"c.sh":                    "#!/bin/sh\n",
+		"SQL.files/d.sql":         "SELECT 1;\n",
+		"../Common/frag/Manifest": "e.sh\n",
+		"../Common/frag/e.sh":     "#!/bin/sh\n",
+	}
+
+	testCases := []struct {
+		testhelper.ID
+		testhelper.ExpErr
+		manifest  string
+		expSteps  []string
+		expGroups [][]string
+	}{
+		{
+			ID:       testhelper.MkID("no groups"),
+			manifest: "a.sh\n# a comment\n\nSQL.files/d.sql # the SQL\n",
+			expSteps: []string{"a.sh", "SQL.files/d.sql"},
+		},
+		{
+			ID: testhelper.MkID("one group"),
+			manifest: "a.sh\n" +
+				"@parallel max=2 on-failure=finish\n" +
+				"b.sh\n" +
+				"c.sh\n" +
+				"@end-parallel\n" +
+				"SQL.files/d.sql\n",
+			expSteps:  []string{"a.sh", "b.sh", "c.sh", "SQL.files/d.sql"},
+			expGroups: [][]string{{"b.sh", "c.sh"}},
+		},
+		{
+			ID: testhelper.MkID("two groups"),
+			manifest: "@parallel\n" +
+				"a.sh\n" +
+				"@end-parallel\n" +
+				"@parallel\n" +
+				"b.sh\n" +
+				"c.sh\n" +
+				"@end-parallel\n",
+			expSteps:  []string{"a.sh", "b.sh", "c.sh"},
+			expGroups: [][]string{{"a.sh"}, {"b.sh", "c.sh"}},
+		},
+		{
+			ID:       testhelper.MkID("include"),
+			manifest: "a.sh\n@include frag\nb.sh\n",
+			expSteps: []string{"a.sh", "../Common/frag/e.sh", "b.sh"},
+		},
+		{
+			ID: testhelper.MkID("nested groups"),
+			ExpErr: testhelper.MkExpErr("Parallel groups cannot be nested",
+				"has not been ended with "+DirectiveEndParallel),
+			manifest: "@parallel\n" +
+				"a.sh\n" +
+				"@parallel\n" +
+				"b.sh\n" +
+				"@end-parallel\n",
+		},
+		{
+			ID: testhelper.MkID("group not ended"),
+			ExpErr: testhelper.MkExpErr(
+				"The parallel group is not ended with " +
+					DirectiveEndParallel),
+			manifest: "a.sh\n@parallel\nb.sh\n",
+		},
+		{
+			ID:       testhelper.MkID("empty group"),
+			ExpErr:   testhelper.MkExpErr("is empty"),
+			manifest: "a.sh\n@parallel\n@end-parallel\n",
+		},
+		{
+			ID: testhelper.MkID("end outside a group"),
+			ExpErr: testhelper.MkExpErr("The " + DirectiveEndParallel +
+				" directive is not in a parallel group"),
+			manifest: "a.sh\n@end-parallel\n",
+		},
+		{
+			ID: testhelper.MkID("end with arguments"),
+			ExpErr: testhelper.MkExpErr("The " + DirectiveEndParallel +
+				" directive takes no arguments"),
+			manifest: "@parallel\na.sh\n@end-parallel now\n",
+		},
+		{
+			ID:       testhelper.MkID("bad group attribute"),
+			ExpErr:   testhelper.MkExpErr(`The "max" attribute must be`),
+			manifest: "@parallel max=0\na.sh\n@end-parallel\n",
+		},
+		{
+			ID: testhelper.MkID("include in a group"),
+			ExpErr: testhelper.MkExpErr("The " + DirectiveInclude +
+				" directive cannot be given in a parallel group"),
+			manifest: "@parallel\na.sh\n@include frag\n@end-parallel\n",
+		},
+		{
+			ID:       testhelper.MkID("unknown directive"),
+			ExpErr:   testhelper.MkExpErr(`Unknown directive: "@serial"`),
+			manifest: "@serial\na.sh\n",
+		},
+		{
+			ID:       testhelper.MkID("missing file"),
+			ExpErr:   testhelper.MkExpErr(`does not contain "x.sh"`),
+			manifest: "a.sh\nx.sh\n",
+		},
+		{
+			ID:       testhelper.MkID("duplicate file"),
+			ExpErr:   testhelper.MkExpErr("already in the manifest"),
+			manifest: "a.sh\na.sh\n",
+		},
+		{
+			ID:       testhelper.MkID("only comments"),
+			ExpErr:   testhelper.MkExpErr("is empty"),
+			manifest: "# nothing to do\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		files := map[string]string{ReleaseManifestFileName: tc.manifest}
+		for name, content := range stepFiles {
+			files[name] = content
+		}
+
+		baseDir := mkTestRelease(t, files)
+		mf := NewManifest(DbtFileReleaseManifest(baseDir, testRelName))
+
+		errs := ParseManifestFile(mf, baseDir, testRelName, "release", true)
+		if !testhelper.CheckExpErr(t, errors.Join(errs...), tc) ||
+			len(errs) != 0 {
+			continue
+		}
+
+		testhelper.DiffStringSlice(t, tc.IDStr(), "steps",
+			stepNames(mf.Steps), tc.expSteps)
+
+		if testhelper.DiffInt(t, tc.IDStr(), "groups",
+			len(mf.Groups), len(tc.expGroups)) {
+			continue
+		}
+
+		for i, g := range mf.Groups {
+			testhelper.DiffStringSlice(t, tc.IDStr(), "group steps",
+				stepNames(g.Steps), tc.expGroups[i])
+
+			for _, s := range g.Steps {
+				if s.Group != g {
+					t.Log(tc.IDStr())
+					t.Errorf("\t: step %q does not refer to its group",
+						s.Name)
+				}
+			}
+		}
+	}
+}
+
+// stepNames returns the names of the steps
+func stepNames(steps []*Step) []string {
+	names := make([]string, 0, len(steps))
+	for _, s := range steps {
+		names = append(names, s.Name)
+	}
+
+	return names
+}
@@ -0,0 +1,262 @@
+package dbtcommon
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// numericPrefix matches the leading digits of a release name
+var numericPrefix = regexp.MustCompile(`^[0-9]+`)
+
+// ReleaseNumericPrefix returns the leading digits of the release name. It
+// returns an empty string if the name does not start with a digit
+func ReleaseNumericPrefix(name string) string {
+	return numericPrefix.FindString(name)
+}
+
+// reservedDirUse maps the names of the directories in the release
+// directory which are not releases to a description of what they hold
+var reservedDirUse = map[string]string{
+	ReleaseArchiveDirName: "archived releases",
+	ReleaseCommonDirName:  "Manifest fragments",
+	ReleaseHooksDirName:   "hooks",
+}
+
+// IsReservedDirName returns true if the name is that of one of the
+// directories in the release directory which are not releases: the
+// Archive, the directory of Manifest fragments and the directory of hooks
+func IsReservedDirName(name string) bool {
+	_, ok := reservedDirUse[name]
+	return ok
+}
+
+// looksLikeRelease returns true if the named directory in the release
+// directory has a Manifest file and so appears to be a release
+func looksLikeRelease(baseDir, name string) bool {
+	_, err := os.Stat(DbtFileReleaseManifest(baseDir, name))
+	return err == nil
+}
+
+// FindReleases finds all the non-archived releases in the release
+// directory. The directories of Manifest fragments and hooks are not
+// releases unless they have a Manifest file, in which case they are
+// returned so that they are not silently ignored; ReleaseDirIsOK will
+// report them as errors
+func FindReleases(baseDir string) ([]string, error) {
+	dir, err := os.Open(DbtDirReleaseBase(baseDir))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	contents, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	ignoreEntry := map[string]bool{
+		".":  true,
+		"..": true,
+	}
+
+	relDirs := make([]string, 0)
+
+	for _, entry := range contents {
+		if ignoreEntry[entry.Name()] || !entry.IsDir() {
+			continue
+		}
+
+		if IsReservedDirName(entry.Name()) &&
+			!looksLikeRelease(baseDir, entry.Name()) {
+			continue
+		}
+
+		relDirs = append(relDirs, entry.Name())
+	}
+
+	sort.Strings(relDirs)
+
+	return relDirs, nil
+}
+
+// ReleaseDirIsOK checks that the release directory exists and returns an
+// error if it does not. It is an error if the release has the name of one
+// of the reserved directories
+func ReleaseDirIsOK(baseDir, relName string) error {
+	if IsReservedDirName(relName) {
+		if looksLikeRelease(baseDir, relName) {
+			return fmt.Errorf(
+				"the %s directory (%s) has a %s file and so looks like a"+
+					" release but the name is reserved for %s."+
+					" It cannot be used as a release; rename it",
+				relName, DbtDirRelease(baseDir, relName),
+				ReleaseManifestFileName, reservedDirUse[relName])
+		}
+
+		return fmt.Errorf(
+			"the %s directory cannot be used as a release directory",
+			relName)
+	}
+
+	relDir := DbtDirRelease(baseDir, relName)
+
+	rdStat, err := os.Stat(relDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("the release directory (%s) does not exist",
+				relDir)
+		}
+
+		return err
+	}
+
+	if !rdStat.IsDir() {
+		return fmt.Errorf("%s is not a directory", relDir)
+	}
+
+	return nil
+}
+
+// ParseReleaseManifests parses the Manifest file of the named release and,
+// if there is one or if needRollback is true, the Rollback file. The
+// Rollback manifest is nil if it was not parsed.
+func ParseReleaseManifests(
+	baseDir, relName string, needRollback, checkSums bool,
+) (mf, rollbackMf *Manifest, errs []error) {
+	mf = NewManifest(DbtFileReleaseManifest(baseDir, relName))
+	errs = ParseManifestFile(mf, baseDir, relName, "release", checkSums)
+
+	rbFile := DbtFileReleaseRollback(baseDir, relName)
+	if _, err := os.Stat(rbFile); err == nil || needRollback {
+		rollbackMf = NewManifest(rbFile)
+		errs = append(errs,
+			ParseManifestFile(rollbackMf, baseDir, relName, "rollback",
+				checkSums)...)
+	}
+
+	return mf, rollbackMf, errs
+}
+
+// CheckForUnusedFiles checks that all the files in the release dir, and
+// any sub-directories (including the SQL directory), are referenced in one
+// of the manifests. The directory holding the transcripts of previous runs
+// is not checked. The files in the directories of any fragments included
+// by the manifests are similarly checked against the fragment's Manifest
+// file
+func CheckForUnusedFiles(baseDir, relName string, mfs ...*Manifest) []error {
+	relDir := DbtDirRelease(baseDir, relName)
+
+	errors := unusedFiles(relDir,
+		map[string]bool{
+			ReleaseManifestFileName: true,
+			ReleaseRollbackFileName: true,
+			ReleaseReadMeFileName:   true,
+			ReleaseWarningFileName:  true,
+			ReleaseApprovalFileName: true,
+		},
+		func(name string) bool {
+			for _, mf := range mfs {
+				if mf.HasFile(name) {
+					return true
+				}
+			}
+
+			return false
+		},
+		func(name string) error {
+			return fmt.Errorf("the release directory (%s) contains %q"+
+				" which is not in the %s or %s file",
+				relDir, name,
+				ReleaseManifestFileName,
+				ReleaseRollbackFileName)
+		})
+
+	checked := map[string]bool{}
+
+	for _, mf := range mfs {
+		if mf == nil {
+			continue
+		}
+
+		for _, frag := range mf.Fragments {
+			if checked[frag.FileName] {
+				continue
+			}
+
+			checked[frag.FileName] = true
+
+			fragDir := filepath.Dir(frag.FileName)
+
+			errors = append(errors, unusedFiles(fragDir,
+				map[string]bool{
+					ReleaseManifestFileName: true,
+					ReleaseReadMeFileName:   true,
+				},
+				frag.HasFile,
+				func(name string) error {
+					return fmt.Errorf("the fragment directory (%s)"+
+						" contains %q which is not in its %s file",
+						fragDir, name, ReleaseManifestFileName)
+				})...)
+		}
+	}
+
+	return errors
+}
+
+// unusedFiles checks that all the files in the directory, and any
+// sub-directories, are either to be ignored or are used. Any directory to
+// be ignored is not checked. It returns an error for each file which is
+// not.
+func unusedFiles(
+	dir string, ignoreEntry map[string]bool,
+	isUsed func(string) bool, unusedErr func(string) error,
+) []error {
+	errors := make([]error, 0)
+
+	err := filepath.WalkDir(dir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				errors = append(errors, err)
+				return nil
+			}
+
+			name, err := filepath.Rel(dir, path)
+			if err != nil {
+				errors = append(errors, err)
+				return nil
+			}
+
+			if d.IsDir() {
+				if name == ReleaseTranscriptDirName || ignoreEntry[name] {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if ignoreEntry[name] || isUsed(name) {
+				return nil
+			}
+
+			// a file holding SQL whose macros have been substituted
+			// is only present while its step is being run
+			if strings.HasPrefix(d.Name(), ExpandedSQLFilePrefix) {
+				return nil
+			}
+
+			errors = append(errors, unusedErr(name))
+
+			return nil
+		})
+	if err != nil {
+		errors = append(errors, err)
+	}
+
+	return errors
+}
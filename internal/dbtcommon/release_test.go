@@ -0,0 +1,71 @@
+package dbtcommon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nickwells/testhelper.mod/v2/testhelper"
+)
+
+const testRelName = "0001_test"
+
+// mkTestRelease creates a release called testRelName holding the given
+// files, under a new base directory which it returns. The file names are
+// relative to the release directory
+func mkTestRelease(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	baseDir := t.TempDir()
+	relDir := DbtDirRelease(baseDir, testRelName)
+
+	for name, content := range files {
+		fName := filepath.Join(relDir, name)
+
+		err := os.MkdirAll(filepath.Dir(fName), 0o755) //nolint:gosec
+		if err != nil {
+			t.Fatal("cannot make the release directory:", err)
+		}
+
+		err = os.WriteFile(fName, []byte(content), 0o644) //nolint:gosec
+		if err != nil {
+			t.Fatal("cannot make the release file:", err)
+		}
+	}
+
+	return baseDir
+}
+
+func TestReleaseNumericPrefix(t *testing.T) {
+	testCases := []struct {
+		testhelper.ID
+		name      string
+		expPrefix string
+	}{
+		{
+			ID:        testhelper.MkID("numeric prefix"),
+			name:      "0012_add_widgets",
+			expPrefix: "0012",
+		},
+		{
+			ID:        testhelper.MkID("all digits"),
+			name:      "20240101",
+			expPrefix: "20240101",
+		},
+		{
+			ID:        testhelper.MkID("digits later in the name"),
+			name:      "add_widgets_2",
+			expPrefix: "",
+		},
+		{
+			ID:        testhelper.MkID("empty name"),
+			name:      "",
+			expPrefix: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		testhelper.DiffString(t, tc.IDStr(), "prefix",
+			ReleaseNumericPrefix(tc.name), tc.expPrefix)
+	}
+}
@@ -1,6 +1,12 @@
 package dbtcommon
 
-import "os/exec"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
 
 // SQLCommand returns the command to be run. The command is the sql runner
 // (psql) with various standard flags applied and running the given filename.
@@ -13,3 +19,92 @@ func SQLCommand(dbp *DBParams, fileName string) *exec.Cmd {
 		"-d", dbp.DbName,
 		"-f", fileName)
 }
+
+// SQLQueryCommand returns a command which will run the given SQL text. The
+// output is unaligned, without headers or footers and with the fields
+// separated by tab characters so that it can be easily parsed. The user's
+// psqlrc file is not read so that the output format is predictable.
+//
+//nolint:gosec
+func SQLQueryCommand(dbp *DBParams, sql string) *exec.Cmd {
+	return exec.Command(dbp.PsqlPath,
+		"-X",
+		"-v", "ON_ERROR_STOP=1",
+		"-q",
+		"-A", "-t",
+		"-F", "\t",
+		"-d", dbp.DbName,
+		"-c", sql)
+}
+
+// SQLSessionCommand returns a command which will run the SQL written to its
+// standard input. The output is formatted as for SQLQueryCommand. The
+// session lasts until the standard input is closed which allows it to
+// hold session-level locks.
+//
+//nolint:gosec
+func SQLSessionCommand(dbp *DBParams) *exec.Cmd {
+	return exec.Command(dbp.PsqlPath,
+		"-X",
+		"-v", "ON_ERROR_STOP=1",
+		"-q",
+		"-A", "-t",
+		"-F", "\t",
+		"-d", dbp.DbName)
+}
+
+// RunSQLQuery runs the given SQL text and returns the rows of output, each
+// split into its fields. Any error message written by psql is included in
+// the returned error.
+func RunSQLQuery(dbp *DBParams, sql string) ([][]string, error) {
+	cmd := SQLQueryCommand(dbp, sql)
+
+	var stderr bytes.Buffer
+
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+
+		return nil, err
+	}
+
+	var rows [][]string
+
+	for line := range strings.Lines(string(out)) {
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			continue
+		}
+
+		rows = append(rows, strings.Split(line, "\t"))
+	}
+
+	return rows, nil
+}
+
+// RunSQLSingleValue runs the given SQL text and returns the single value it
+// produces. It is an error if the query returns anything other than one row
+// with one field.
+func RunSQLSingleValue(dbp *DBParams, sql string) (string, error) {
+	rows, err := RunSQLQuery(dbp, sql)
+	if err != nil {
+		return "", err
+	}
+
+	if len(rows) != 1 || len(rows[0]) != 1 {
+		return "", errors.New("the query did not return a single value")
+	}
+
+	return rows[0][0], nil
+}
+
+// QuoteLiteral returns the string quoted so that it can be safely used as
+// an SQL string literal
+func QuoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,15 @@
+package dbtcommon
+
+import "runtime/debug"
+
+// ToolVersion returns the version of the running program as recorded in
+// the build information. If there is no version information available it
+// returns "unknown"
+func ToolVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok || bi.Main.Version == "" {
+		return "unknown"
+	}
+
+	return bi.Main.Version
+}